@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+
+	cli "github.com/jawher/mow.cli"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+// authOptions configure the credentials sent with every call to the fulfilment archive api.
+type authOptions struct {
+	token         *string
+	tokenFile     *string
+	headers       *[]string
+	allowInsecure *bool
+}
+
+func addAuthOptions(cmd *cli.Cmd) *authOptions {
+	return &authOptions{
+		token: cmd.String(cli.StringOpt{
+			Name:      "token",
+			Desc:      "A bearer token to authenticate to the fulfilment archive api with",
+			EnvVar:    "FFAAC_TOKEN",
+			HideValue: true,
+		}),
+		tokenFile: cmd.String(cli.StringOpt{
+			Name:   "token-file",
+			Desc:   "A file with the bearer token to authenticate with, read again whenever it changes",
+			EnvVar: "TOKEN_FILE",
+		}),
+		headers: cmd.Strings(cli.StringsOpt{
+			Name:      "header",
+			Desc:      "A key=value gRPC metadata to send with every call. Can be repeated",
+			EnvVar:    "HEADERS",
+			HideValue: true,
+		}),
+		allowInsecure: cmd.Bool(cli.BoolOpt{
+			Name:   "allow-insecure-token",
+			Desc:   "Send the bearer token even when the connection does not use TLS",
+			EnvVar: "ALLOW_INSECURE_TOKEN",
+			Value:  false,
+		}),
+	}
+}
+
+// credentials returns the per call credentials configured by the options.
+func (o *authOptions) credentials() ([]credentials.PerRPCCredentials, error) {
+	var creds []credentials.PerRPCCredentials
+
+	switch {
+	case *o.token != "" && *o.tokenFile != "":
+		return nil, errors.New("--token and --token-file cannot be used together")
+	case *o.token != "":
+		token, err := grpcclient.BearerToken(*o.token, *o.allowInsecure)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, token)
+	case *o.tokenFile != "":
+		token, err := grpcclient.BearerTokenFile(*o.tokenFile, *o.allowInsecure)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, token)
+	}
+
+	if len(*o.headers) > 0 {
+		headers, err := grpcclient.ParseHeaders(*o.headers)
+		if err != nil {
+			return nil, err
+		}
+		creds = append(creds, grpcclient.StaticHeaders(headers))
+	}
+	return creds, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+type newDeleterFunc func(faaClient bfaa.BillFulfilmentArchiveAPIClient, workers int, dryRun bool) *ffaac.ArchiveDeleter
+
+// deleteCommand returns the initialiser of a delete command, where keyArg is the name of the argument
+// holding the key to delete (e.g. ACCOUNT_NUMBER), and keysFileOpt the name of the option to read many keys from a file.
+func deleteCommand(dial dialFunc, keyArg string, keyDesc string, keysFileOpt string, newDeleter newDeleterFunc) cli.CmdInitializer {
+	return func(cmd *cli.Cmd) {
+		cmd.Spec = fmt.Sprintf("[OPTIONS] (--%s | %s)", keysFileOpt, keyArg)
+
+		key := cmd.String(cli.StringArg{
+			Name: keyArg,
+			Desc: fmt.Sprintf("The %s whose archive to delete", keyDesc),
+		})
+
+		keysFile := cmd.String(cli.StringOpt{
+			Name: keysFileOpt,
+			Desc: fmt.Sprintf("A file listing one %s per line to delete. Use - to read from stdin", keyDesc),
+		})
+
+		yes := cmd.Bool(cli.BoolOpt{
+			Name:  "y yes",
+			Desc:  "Do not ask for confirmation before deleting",
+			Value: false,
+		})
+
+		dryRun := cmd.Bool(cli.BoolOpt{
+			Name:  "dry-run",
+			Desc:  "Only look up and log the archives which would be deleted, without deleting anything",
+			Value: false,
+		})
+
+		workers := cmd.Int(cli.IntOpt{
+			Name:   "w workers",
+			Desc:   "The number of workers to use for deleting in parallel",
+			EnvVar: "WORKERS",
+			Value:  10,
+		})
+
+		cmd.Action = func() {
+			if !*dryRun && !*yes {
+				if *keysFile == "-" {
+					log.Errorf("--yes is required when reading the list of %ss from stdin", keyDesc)
+					cli.Exit(exitCodeWithError)
+				}
+
+				what := fmt.Sprintf("the archive for %s %s", keyDesc, *key)
+				if *keysFile != "" {
+					what = fmt.Sprintf("the archives for all the %ss listed in %s", keyDesc, *keysFile)
+				}
+				if !confirm(os.Stdin, os.Stderr, fmt.Sprintf("Delete %s from the fulfilment archive?", what)) {
+					log.Info("Deletion cancelled")
+					return
+				}
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			fulfilmentArchAPIConn := dial(ctx)
+			defer closeGRPCClientConnection(fulfilmentArchAPIConn)
+
+			log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
+
+			keysReader, closeKeys := keysReaderFromArgs(*keysFile, *key)
+			defer closeKeys()
+
+			deleter := newDeleter(bfaa.NewBillFulfilmentArchiveAPIClient(fulfilmentArchAPIConn), *workers, *dryRun)
+			if err := deleter.Delete(ctx, keysReader); err != nil {
+				log.WithError(err).Errorf("Got error while deleting the archives")
+				cli.Exit(exitCodeWithError)
+			}
+		}
+	}
+}
+
+// confirm asks the question on out and returns true only if the answer read from in is yes.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func exportAccountCommand(cmd *cli.Cmd, dial dialFunc) {
+	cmd.Spec = "[OPTIONS] --out (--accounts-file | ACCOUNT_NUMBER)"
+
+	accountNumber := cmd.String(cli.StringArg{
+		Name: "ACCOUNT_NUMBER",
+		Desc: "The account number whose archives to export",
+	})
+
+	accountsFile := cmd.String(cli.StringOpt{
+		Name: "accounts-file",
+		Desc: "A file listing one account number per line to export. Use - to read from stdin",
+	})
+
+	out := cmd.String(cli.StringOpt{
+		Name: "o out",
+		Desc: "The directory where to write the archives and the index file to",
+	})
+
+	workers := cmd.Int(cli.IntOpt{
+		Name:   "w workers",
+		Desc:   "The number of workers to use for downloading in parallel",
+		EnvVar: "WORKERS",
+		Value:  10,
+	})
+
+	cmd.Action = func() {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		fulfilmentArchAPIConn := dial(ctx)
+		defer closeGRPCClientConnection(fulfilmentArchAPIConn)
+
+		log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
+
+		keysReader, closeKeys := keysReaderFromArgs(*accountsFile, *accountNumber)
+		defer closeKeys()
+
+		exporter := ffaac.NewAccountArchiveExporter(bfaa.NewBillFulfilmentArchiveAPIClient(fulfilmentArchAPIConn), *out, *workers)
+		if err := exporter.Export(ctx, keysReader); err != nil {
+			log.WithError(err).Errorf("Got error while exporting the archives")
+			cli.Exit(exitCodeWithError)
+		}
+	}
+}
+
+func getByRequestIDCommand(cmd *cli.Cmd, dial dialFunc) {
+	cmd.Spec = "[OPTIONS] --out (--request-ids-file | REQUEST_ID)"
+
+	requestID := cmd.String(cli.StringArg{
+		Name: "REQUEST_ID",
+		Desc: "The fulfilment request ID whose archives to download",
+	})
+
+	requestIDsFile := cmd.String(cli.StringOpt{
+		Name: "request-ids-file",
+		Desc: "A file listing one fulfilment request ID per line to download. Use - to read from stdin",
+	})
+
+	out := cmd.String(cli.StringOpt{
+		Name: "o out",
+		Desc: "The directory where to write the archives and the index file to",
+	})
+
+	workers := cmd.Int(cli.IntOpt{
+		Name:   "w workers",
+		Desc:   "The number of workers to use for downloading in parallel",
+		EnvVar: "WORKERS",
+		Value:  10,
+	})
+
+	cmd.Action = func() {
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		fulfilmentArchAPIConn := dial(ctx)
+		defer closeGRPCClientConnection(fulfilmentArchAPIConn)
+
+		log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
+
+		keysReader, closeKeys := keysReaderFromArgs(*requestIDsFile, *requestID)
+		defer closeKeys()
+
+		exporter := ffaac.NewRequestIDArchiveExporter(bfaa.NewBillFulfilmentArchiveAPIClient(fulfilmentArchAPIConn), *out, *workers)
+		if err := exporter.Export(ctx, keysReader); err != nil {
+			log.WithError(err).Errorf("Got error while downloading the archives")
+			cli.Exit(exitCodeWithError)
+		}
+	}
+}
+
+// keysReaderFromArgs reads the keys from keysFile if set, otherwise it uses the single key given as argument.
+func keysReaderFromArgs(keysFile string, key string) (ffaac.KeysReader, func()) {
+	if keysFile == "" {
+		return ffaac.KeysFromList(key), func() {}
+	}
+
+	var r io.ReadCloser = os.Stdin
+	if keysFile != "-" {
+		f, err := os.Open(keysFile)
+		if err != nil {
+			log.WithError(err).Errorf("failed opening %s", keysFile)
+			cli.Exit(exitCodeWithError)
+		}
+		r = f
+	}
+	return ffaac.KeysFromReader(r), func() {
+		if err := r.Close(); err != nil {
+			log.WithError(err).Errorf("failed closing %s", keysFile)
+		}
+	}
+}
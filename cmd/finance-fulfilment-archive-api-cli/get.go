@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func getCommand(cmd *cli.Cmd, dial dialFunc) {
+	cmd.Spec = "[OPTIONS] ID"
+
+	id := cmd.String(cli.StringArg{
+		Name: "ID",
+		Desc: "The ID of the archive to download",
+	})
+
+	out := cmd.String(cli.StringOpt{
+		Name:  "o out",
+		Desc:  "The file where to write the archive to. If empty or -, the archive is written to stdout",
+		Value: "",
+	})
+
+	cmd.Action = func() {
+		toStdout := *out == "" || *out == "-"
+		if toStdout {
+			//	keep stdout clean for the archive data
+			log.SetOutput(os.Stderr)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		fulfilmentArchAPIConn := dial(ctx)
+		defer closeGRPCClientConnection(fulfilmentArchAPIConn)
+
+		downloader := ffaac.NewArchiveDownloader(bfaa.NewBillFulfilmentArchiveAPIClient(fulfilmentArchAPIConn))
+
+		log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
+
+		var err error
+		if toStdout {
+			err = downloader.Download(ctx, *id, os.Stdout)
+		} else {
+			err = downloader.DownloadToFile(ctx, *id, *out)
+		}
+		if err != nil {
+			log.WithError(err).Errorf("Got error while downloading archive %s", *id)
+			cli.Exit(exitCodeWithError)
+		}
+		if !toStdout {
+			log.Infof("Archive %s written to %s", *id, *out)
+		}
+	}
+}
@@ -2,32 +2,43 @@ package main
 
 import (
 	"context"
-	"math"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 	"time"
 
-	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
-	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	cli "github.com/jawher/mow.cli"
 	log "github.com/sirupsen/logrus"
-	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
 )
 
 var version string // populated at compile time
 
 const (
 	appName           = "finance-fulfilment-archive-api-cli"
-	appDesc           = "This application is used to upload items to finance-fulfilment-archive"
+	appDesc           = "This application is used to upload and retrieve items from finance-fulfilment-archive"
 	exitCodeWithError = 1
+	// exitCodeWithDiscrepancies is returned by verify when the archive does not match the local files
+	exitCodeWithDiscrepancies = 2
 )
 
+// connectionConfig is the configuration of the connection to the fulfilment archive api, parsed from the global options.
+type connectionConfig struct {
+	retryPolicy grpcclient.RetryPolicy
+	creds       credentials.TransportCredentials
+	perRPCCreds []credentials.PerRPCCredentials
+	callTimeout time.Duration
+	// callTimeoutPerMiB is added to callTimeout for every MiB of the request
+	callTimeoutPerMiB time.Duration
+}
+
+// dialFunc opens a connection to the fulfilment archive api, using the options shared by all the commands.
+// The interceptors of the command are run after the retries, once per attempt.
+type dialFunc func(ctx context.Context, interceptors ...grpc.UnaryClientInterceptor) *grpc.ClientConn
+
 func main() {
 	app := cli.App(appName, appDesc)
 
@@ -58,81 +69,84 @@ func main() {
 		Value:  "json",
 	})
 
-	workers := app.Int(cli.IntOpt{
-		Name:   "w workers",
-		Desc:   "The number of workers to use for uploading in parallel",
-		EnvVar: "WORKERS",
-		Value:  10,
-	})
-
-	recursive := app.Bool(cli.BoolOpt{
-		Name:   "r recursive",
-		Desc:   "Upload recursively all the files in the specified folder",
-		EnvVar: "RECURSIVE",
-		Value:  true,
+	metricsAddr := app.String(cli.StringOpt{
+		Name:   "metrics-addr",
+		Desc:   "The address where to serve the Prometheus metrics over HTTP, at /metrics, while the command runs, e.g. :8081",
+		EnvVar: "METRICS_ADDR",
 	})
 
-	basedir := app.String(cli.StringArg{
-		Name:   "BASEDIR",
-		Desc:   "The base directory where to upload all the files from",
-		EnvVar: "BASEDIR",
+	metricsTextfile := app.String(cli.StringOpt{
+		Name:   "metrics-textfile",
+		Desc:   "A file where to write the Prometheus metrics when the command ends, for the node exporter textfile collector. Should end in .prom",
+		EnvVar: "METRICS_TEXTFILE",
 	})
 
-	fileExtensions := app.String(cli.StringOpt{
-		Name:   "e file-extensions",
-		Desc:   "The list of file extensions to process",
-		EnvVar: "FILE_EXTENSIONS",
-		Value:  "pdf,csv",
-	})
+	retryOpts := addRetryOptions(app.Cmd)
+	callTimeoutOpts := addCallTimeoutOptions(app.Cmd)
+	tlsOpts := addTLSOptions(app.Cmd)
+	authOpts := addAuthOptions(app.Cmd)
 
-	app.Action = func() {
+	var connConfig connectionConfig
+	app.Before = func() {
 		configureLogger(*logLevel, *logFormat)
+		if *metricsAddr != "" {
+			serveMetrics(*metricsAddr)
+		}
 
-		ctx, cancel := context.WithCancel(context.Background())
-
-		fulfilmentArchAPIConn := initialiseGRPCClientConnection(ctx, fulfilmentArchAPIAddr, fulfilmentArchAPIgrpcLB)
-		defer func() {
-			if err := fulfilmentArchAPIConn.Close(); err != nil {
-				log.WithError(err).Error("error while shutting down fulfilment archive api connection")
-			}
-		}()
-
-		faaClient := bfaa.NewBillFulfilmentArchiveAPIClient(fulfilmentArchAPIConn)
-
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-
-		doneCh := make(chan bool)
-		defer close(doneCh)
-
-		log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
-		log.Infof("Starting processing files in %s. Recursive: %v. Looking for files with extensions: %v", *basedir, *recursive, *fileExtensions)
-
-		filesFinder := ffaac.NewFilesFinder(*basedir, *recursive, strings.Split(*fileExtensions, ","))
-		filesProcessor := ffaac.NewFileProcessor(faaClient, *basedir, *workers, filesFinder)
-
-		var procErr error
-		go func() {
-			procErr = filesProcessor.ProcessFiles(ctx)
-			doneCh <- true
-		}()
-
-		go func() {
-			<-sigChan
-			//	cancel the context so that all processing should stop
-			cancel()
-		}()
-
-		//	wait for the processor to finish
-		<-doneCh
-		close(sigChan)
-
-		if procErr != nil {
-			log.WithError(procErr).Errorf("Got error while processing the files")
+		var err error
+		if connConfig.retryPolicy, err = retryOpts.policy(); err != nil {
+			log.WithError(err).Error("Got error while parsing the retry options")
+			cli.Exit(exitCodeWithError)
+		}
+		if connConfig.callTimeout, connConfig.callTimeoutPerMiB, err = callTimeoutOpts.parse(); err != nil {
+			log.WithError(err).Error("Got error while parsing the call timeout options")
 			cli.Exit(exitCodeWithError)
 		}
+		if connConfig.creds, err = tlsOpts.credentials(); err != nil {
+			log.WithError(err).Error("Got error while loading the TLS certificates")
+			cli.Exit(exitCodeWithError)
+		}
+		if connConfig.perRPCCreds, err = authOpts.credentials(); err != nil {
+			log.WithError(err).Error("Got error while parsing the authentication options")
+			cli.Exit(exitCodeWithError)
+		}
+	}
+
+	app.After = func() {
+		if *metricsTextfile != "" {
+			writeMetricsTextfile(*metricsTextfile)
+		}
 	}
 
+	dial := func(ctx context.Context, interceptors ...grpc.UnaryClientInterceptor) *grpc.ClientConn {
+		return initialiseGRPCClientConnection(ctx, fulfilmentArchAPIAddr, fulfilmentArchAPIgrpcLB, connConfig, interceptors)
+	}
+
+	app.Command("upload", "Upload all the files in a folder to the fulfilment archive", func(cmd *cli.Cmd) {
+		uploadCommand(cmd, dial)
+	})
+	app.Command("retry-failures", "Upload again the files listed in the failure report of a previous upload", func(cmd *cli.Cmd) {
+		retryFailuresCommand(cmd, dial)
+	})
+	app.Command("verify", "Check that all the files in a folder have been archived with the same content", func(cmd *cli.Cmd) {
+		verifyCommand(cmd, dial)
+	})
+	app.Command("get", "Download an archive by ID", func(cmd *cli.Cmd) {
+		getCommand(cmd, dial)
+	})
+	app.Command("export-account", "Download all the archives of one or more account numbers to a directory", func(cmd *cli.Cmd) {
+		exportAccountCommand(cmd, dial)
+	})
+	app.Command("get-by-request-id", "Download all the archives produced by one or more fulfilment requests to a directory", func(cmd *cli.Cmd) {
+		getByRequestIDCommand(cmd, dial)
+	})
+	app.Command("delete", "Delete archives by ID",
+		deleteCommand(dial, "ID", "ID", "ids-file", ffaac.NewArchiveDeleter))
+	app.Command("delete-account", "Delete archives by account number",
+		deleteCommand(dial, "ACCOUNT_NUMBER", "account number", "accounts-file", ffaac.NewAccountArchiveDeleter))
+	app.Command("delete-request", "Delete archives by fulfilment request ID",
+		deleteCommand(dial, "REQUEST_ID", "fulfilment request ID", "request-ids-file", ffaac.NewRequestIDArchiveDeleter))
+
 	if err := app.Run(os.Args); err != nil {
 		log.WithError(err).Panic("unable to run app")
 	}
@@ -157,24 +171,30 @@ func configureLogger(level, format string) {
 	log.SetOutput(os.Stdout)
 }
 
-func initialiseGRPCClientConnection(ctx context.Context, grpcClientAddress *string, grpcLoadBalancer *string) *grpc.ClientConn {
-	opts := []grpc.DialOption{
-		grpc.WithDefaultCallOptions(
-			grpc.MaxCallRecvMsgSize(math.MaxInt32),
-			grpc.MaxCallSendMsgSize(math.MaxInt32),
-		),
-		grpc.WithInsecure(),
-		grpc.WithUnaryInterceptor(grpc_prometheus.UnaryClientInterceptor),
-		grpc.WithUnaryInterceptor(grpc_retry.UnaryClientInterceptor(
-			[]grpc_retry.CallOption{
-				grpc_retry.WithBackoff(grpc_retry.BackoffLinearWithJitter(100*time.Millisecond, 0.1)),
-				grpc_retry.WithMax(3),
-				grpc_retry.WithCodes(codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable),
-			}...,
-		)),
+func closeGRPCClientConnection(conn *grpc.ClientConn) {
+	if err := conn.Close(); err != nil {
+		log.WithError(err).Error("error while shutting down fulfilment archive api connection")
+	}
+}
+
+func initialiseGRPCClientConnection(ctx context.Context, grpcClientAddress *string, grpcLoadBalancer *string, connConfig connectionConfig,
+	commandInterceptors []grpc.UnaryClientInterceptor) *grpc.ClientConn {
+	//	retry first, so that all the interceptors after it see every attempt, and every attempt gets its own deadline
+	interceptors := []grpc.UnaryClientInterceptor{grpcclient.RetryInterceptor(connConfig.retryPolicy)}
+	interceptors = append(interceptors, commandInterceptors...)
+	interceptors = append(interceptors,
+		grpcclient.CallTimeoutInterceptor(connConfig.callTimeout, connConfig.callTimeoutPerMiB),
+		grpcclient.MetricsInterceptor(),
+		grpcclient.LoggingInterceptor(),
+		ffaac.AttemptsCounterInterceptor,
+	)
+
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(connConfig.creds)}
+	for _, creds := range connConfig.perRPCCreds {
+		opts = append(opts, grpc.WithPerRPCCredentials(creds))
 	}
 
-	grpcClientConn, err := grpc.DialContext(ctx, *grpcClientAddress, opts...)
+	grpcClientConn, err := grpcclient.Dial(ctx, *grpcClientAddress, interceptors, opts...)
 
 	if err != nil {
 		log.WithFields(log.Fields{"grpc_client_address": *grpcClientAddress}).
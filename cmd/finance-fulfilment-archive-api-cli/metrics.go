@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+// serveMetrics serves the metrics of the default registry, where the gRPC client metrics are, in the background.
+func serveMetrics(addr string) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.WithFields(log.Fields{"metrics_addr": addr}).
+			WithError(err).
+			Panic("failed listening for the metrics")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			log.WithError(err).Error("error while serving the metrics")
+		}
+	}()
+	log.Infof("Serving metrics on %s/metrics", listener.Addr())
+}
+
+// writeMetricsTextfile writes the metrics of the default registry to path, replacing it atomically.
+func writeMetricsTextfile(path string) {
+	if err := prometheus.WriteToTextfile(path, prometheus.DefaultGatherer); err != nil {
+		log.WithError(err).Errorf("failed writing the metrics to %s", path)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+// retryOptions configure the retries of all the calls to the fulfilment archive api.
+type retryOptions struct {
+	maxAttempts    *int
+	initialBackoff *string
+	maxBackoff     *string
+	jitter         *string
+	maxElapsedTime *string
+	codes          *[]string
+}
+
+func addRetryOptions(cmd *cli.Cmd) *retryOptions {
+	defaults := grpcclient.DefaultRetryPolicy()
+	defaultCodes := make([]string, 0, len(defaults.RetryableCodes))
+	for _, c := range defaults.RetryableCodes {
+		defaultCodes = append(defaultCodes, c.String())
+	}
+
+	return &retryOptions{
+		maxAttempts: cmd.Int(cli.IntOpt{
+			Name:   "retry-max-attempts",
+			Desc:   "The maximum number of attempts of every call to the fulfilment archive api, the first one included. 1 disables the retries",
+			EnvVar: "RETRY_MAX_ATTEMPTS",
+			Value:  defaults.MaxAttempts,
+		}),
+		initialBackoff: cmd.String(cli.StringOpt{
+			Name:   "retry-initial-backoff",
+			Desc:   "The wait before the first retry, doubled at every following one",
+			EnvVar: "RETRY_INITIAL_BACKOFF",
+			Value:  defaults.InitialBackoff.String(),
+		}),
+		maxBackoff: cmd.String(cli.StringOpt{
+			Name:   "retry-max-backoff",
+			Desc:   "The maximum wait between two retries",
+			EnvVar: "RETRY_MAX_BACKOFF",
+			Value:  defaults.MaxBackoff.String(),
+		}),
+		jitter: cmd.String(cli.StringOpt{
+			Name:   "retry-jitter",
+			Desc:   "The fraction, between 0 and 1, of every wait randomly added to or removed from it",
+			EnvVar: "RETRY_JITTER",
+			Value:  strconv.FormatFloat(defaults.Jitter, 'f', -1, 64),
+		}),
+		maxElapsedTime: cmd.String(cli.StringOpt{
+			Name:   "retry-max-elapsed-time",
+			Desc:   "Stop retrying a call once it would take longer than this, waits included. 0 means no limit",
+			EnvVar: "RETRY_MAX_ELAPSED_TIME",
+			Value:  defaults.MaxElapsedTime.String(),
+		}),
+		codes: cmd.Strings(cli.StringsOpt{
+			Name:   "retry-codes",
+			Desc:   "The gRPC status codes of the failures to retry",
+			EnvVar: "RETRY_CODES",
+			Value:  defaultCodes,
+		}),
+	}
+}
+
+// policy parses the options into a retry policy.
+func (o *retryOptions) policy() (grpcclient.RetryPolicy, error) {
+	policy := grpcclient.RetryPolicy{MaxAttempts: *o.maxAttempts}
+
+	var err error
+	for _, d := range []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"retry-initial-backoff", *o.initialBackoff, &policy.InitialBackoff},
+		{"retry-max-backoff", *o.maxBackoff, &policy.MaxBackoff},
+		{"retry-max-elapsed-time", *o.maxElapsedTime, &policy.MaxElapsedTime},
+	} {
+		if *d.dst, err = time.ParseDuration(d.value); err != nil {
+			return policy, fmt.Errorf("invalid --%s: %w", d.name, err)
+		}
+	}
+
+	if policy.Jitter, err = strconv.ParseFloat(*o.jitter, 64); err != nil {
+		return policy, fmt.Errorf("invalid --retry-jitter: %w", err)
+	}
+	if policy.RetryableCodes, err = grpcclient.ParseCodes(*o.codes); err != nil {
+		return policy, fmt.Errorf("invalid --retry-codes: %w", err)
+	}
+	return policy, policy.Validate()
+}
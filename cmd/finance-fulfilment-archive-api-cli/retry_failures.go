@@ -0,0 +1,41 @@
+package main
+
+import (
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func retryFailuresCommand(cmd *cli.Cmd, dial dialFunc) {
+	reportPath := cmd.String(cli.StringArg{
+		Name: "REPORT",
+		Desc: "The failure report written by a previous upload run with --continue-on-error",
+	})
+
+	//	no env var, so that the BASEDIR of the uploads does not override the one recorded in the report
+	basedir := cmd.String(cli.StringOpt{
+		Name: "basedir",
+		Desc: "The base directory of the failed files, if different from the one recorded in the report",
+	})
+
+	opts := addUploadOptions(cmd)
+
+	cmd.Action = func() {
+		opts.redirectLogs()
+		log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
+
+		report, err := ffaac.ReadFailureReport(*reportPath)
+		if err != nil {
+			log.WithError(err).Error("Got error while reading the failure report")
+			cli.Exit(exitCodeWithError)
+		}
+
+		if *basedir == "" {
+			*basedir = report.Basedir
+		}
+		log.Infof("Retrying %d failed files in %s", len(report.Failures), *basedir)
+
+		runUpload(dial, opts, *basedir, ffaac.NewListFilesFinder(report.Paths()))
+	}
+}
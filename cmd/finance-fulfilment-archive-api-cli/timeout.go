@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+)
+
+// callTimeoutOptions configure the deadline of every attempt of the calls to the fulfilment archive api.
+type callTimeoutOptions struct {
+	timeout *string
+	perMiB  *string
+}
+
+func addCallTimeoutOptions(cmd *cli.Cmd) *callTimeoutOptions {
+	return &callTimeoutOptions{
+		timeout: cmd.String(cli.StringOpt{
+			Name:   "call-timeout",
+			Desc:   "The time every attempt of a call to the fulfilment archive api has to complete. 0 means no limit",
+			EnvVar: "CALL_TIMEOUT",
+			Value:  "0s",
+		}),
+		perMiB: cmd.String(cli.StringOpt{
+			Name:   "call-timeout-per-mib",
+			Desc:   "The time added to --call-timeout for every MiB sent, to give more time to the larger files",
+			EnvVar: "CALL_TIMEOUT_PER_MIB",
+			Value:  "0s",
+		}),
+	}
+}
+
+// parse returns the call timeout and the time added to it per MiB sent.
+func (o *callTimeoutOptions) parse() (timeout time.Duration, perMiB time.Duration, err error) {
+	if timeout, err = parseDuration("call-timeout", *o.timeout); err != nil {
+		return 0, 0, err
+	}
+	if perMiB, err = parseDuration("call-timeout-per-mib", *o.perMiB); err != nil {
+		return 0, 0, err
+	}
+	if perMiB > 0 && timeout == 0 {
+		return 0, 0, errors.New("--call-timeout-per-mib requires --call-timeout")
+	}
+	return timeout, perMiB, nil
+}
+
+// parseDuration parses the value of the duration option name, which cannot be negative.
+func parseDuration(name string, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --%s: %w", name, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid --%s: cannot be negative", name)
+	}
+	return d, nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	cli "github.com/jawher/mow.cli"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+// tlsOptions configure the TLS connection to the fulfilment archive api.
+type tlsOptions struct {
+	enabled    *bool
+	caCert     *string
+	clientCert *string
+	clientKey  *string
+	serverName *string
+}
+
+func addTLSOptions(cmd *cli.Cmd) *tlsOptions {
+	return &tlsOptions{
+		enabled: cmd.Bool(cli.BoolOpt{
+			Name:   "tls",
+			Desc:   "Connect to the fulfilment archive api over TLS. Implied by the other TLS options",
+			EnvVar: "TLS",
+			Value:  false,
+		}),
+		caCert: cmd.String(cli.StringOpt{
+			Name:   "ca-cert",
+			Desc:   "A PEM file with the CA certificates to verify the server with, instead of the system ones",
+			EnvVar: "CA_CERT",
+		}),
+		clientCert: cmd.String(cli.StringOpt{
+			Name:   "client-cert",
+			Desc:   "A PEM file with the client certificate, for mutual TLS. Requires --client-key",
+			EnvVar: "CLIENT_CERT",
+		}),
+		clientKey: cmd.String(cli.StringOpt{
+			Name:   "client-key",
+			Desc:   "A PEM file with the key of the client certificate",
+			EnvVar: "CLIENT_KEY",
+		}),
+		serverName: cmd.String(cli.StringOpt{
+			Name:   "server-name",
+			Desc:   "The name to verify the server certificate against, if different from the host of the address",
+			EnvVar: "FFAAC_SERVER_NAME",
+		}),
+	}
+}
+
+// credentials returns the transport credentials configured by the options, insecure if TLS is not enabled.
+func (o *tlsOptions) credentials() (credentials.TransportCredentials, error) {
+	if !*o.enabled && *o.caCert == "" && *o.clientCert == "" && *o.clientKey == "" && *o.serverName == "" {
+		return insecure.NewCredentials(), nil
+	}
+
+	return grpcclient.TransportCredentials(grpcclient.TLSConfig{
+		CACertFile:     *o.caCert,
+		ClientCertFile: *o.clientCert,
+		ClientKeyFile:  *o.clientKey,
+		ServerName:     *o.serverName,
+	})
+}
@@ -0,0 +1,563 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	cli "github.com/jawher/mow.cli"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+// uploadOptions are the options shared by all the commands uploading files.
+type uploadOptions struct {
+	workers           *int
+	journalPath       *string
+	resume            *bool
+	continueOnError   *bool
+	failureReportPath *string
+	previewIDs        *bool
+	dryRun            *bool
+	skipExisting      *bool
+	overwriteChanged  *bool
+	runTimeout        *string
+	maxRPS            *string
+	maxBytesPerSec    *int
+	adaptive          *bool
+	minWorkers        *int
+	maxLatency        *string
+	drainTimeout      *string
+	*idOptions
+}
+
+// idOptions are the options building the archive IDs from the paths of the files.
+type idOptions struct {
+	idTemplate    *string
+	idRegex       *string
+	idPrefix      *string
+	idStripPrefix *string
+	idMap         *string
+	idMapStrict   *bool
+}
+
+func addIDOptions(cmd *cli.Cmd) *idOptions {
+	return &idOptions{
+		idTemplate: cmd.String(cli.StringOpt{
+			Name:   "id-template",
+			Desc:   "The template of the archive IDs, with the placeholders {path}, {dir}, {base}, {stem}, {ext} and the --id-regex groups {1}, {2}, ... or {name}. Defaults to the path relative to the base dir",
+			EnvVar: "ID_TEMPLATE",
+		}),
+		idRegex: cmd.String(cli.StringOpt{
+			Name:   "id-regex",
+			Desc:   "A regex matched against the path relative to the base dir, whose groups can be used in --id-template. Files not matching it fail",
+			EnvVar: "ID_REGEX",
+		}),
+		idPrefix: cmd.String(cli.StringOpt{
+			Name:   "id-prefix",
+			Desc:   "A prefix added to all the archive IDs",
+			EnvVar: "ID_PREFIX",
+		}),
+		idStripPrefix: cmd.String(cli.StringOpt{
+			Name:   "id-strip-prefix",
+			Desc:   "The leading dirs removed from the path relative to the base dir before building the archive ID",
+			EnvVar: "ID_STRIP_PREFIX",
+		}),
+		idMap: cmd.String(cli.StringOpt{
+			Name:   "id-map",
+			Desc:   "A CSV, or TSV if named *.tsv, mapping the files, by path relative to the base dir or by name, to their archive IDs",
+			EnvVar: "ID_MAP",
+		}),
+		idMapStrict: cmd.Bool(cli.BoolOpt{
+			Name:   "id-map-strict",
+			Desc:   "Fail the files missing from --id-map, instead of building their IDs from their paths",
+			EnvVar: "ID_MAP_STRICT",
+			Value:  false,
+		}),
+	}
+}
+
+// finderOptions are the options selecting the files found by walking the base dir.
+type finderOptions struct {
+	recursive      *bool
+	fileExtensions *string
+	includes       *[]string
+	excludes       *[]string
+	ignoreFile     *string
+}
+
+func addFinderOptions(cmd *cli.Cmd, verb string) *finderOptions {
+	return &finderOptions{
+		recursive: cmd.Bool(cli.BoolOpt{
+			Name:   "r recursive",
+			Desc:   verb + " recursively all the files in the specified folder",
+			EnvVar: "RECURSIVE",
+			Value:  true,
+		}),
+		fileExtensions: cmd.String(cli.StringOpt{
+			Name:   "e file-extensions",
+			Desc:   "The list of file extensions to process",
+			EnvVar: "FILE_EXTENSIONS",
+			Value:  "pdf,csv",
+		}),
+		includes: cmd.Strings(cli.StringsOpt{
+			Name:   "i include",
+			Desc:   verb + " only the files whose path relative to BASEDIR matches one of these patterns. Doublestar globs, or regexes when prefixed by re:",
+			EnvVar: "INCLUDE",
+		}),
+		excludes: cmd.Strings(cli.StringsOpt{
+			Name:   "x exclude",
+			Desc:   "Skip the files and dirs whose path relative to BASEDIR matches one of these patterns. Doublestar globs, or regexes when prefixed by re:",
+			EnvVar: "EXCLUDE",
+		}),
+		ignoreFile: cmd.String(cli.StringOpt{
+			Name:   "ignore-file",
+			Desc:   "The name of the files, in gitignore syntax, listing the files not to " + strings.ToLower(verb) + " from their dir and below. Set to empty to disable",
+			EnvVar: "IGNORE_FILE",
+			Value:  ffaac.DefaultIgnoreFileName,
+		}),
+	}
+}
+
+// filesFinder returns the finder walking basedir, as configured by the options.
+func (o *finderOptions) filesFinder(basedir string) (ffaac.FilesFinder, error) {
+	log.Infof("Starting processing files in %s. Recursive: %v. Looking for files with extensions: %v. Include: %v. Exclude: %v",
+		basedir, *o.recursive, *o.fileExtensions, *o.includes, *o.excludes)
+
+	fileFilter, err := ffaac.NewFileFilter(*o.includes, *o.excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	return ffaac.NewFilesFinder(basedir, *o.recursive, strings.Split(*o.fileExtensions, ","),
+		ffaac.WithFileFilter(fileFilter), ffaac.WithIgnoreFiles(*o.ignoreFile)), nil
+}
+
+func addUploadOptions(cmd *cli.Cmd) *uploadOptions {
+	return &uploadOptions{
+		workers: cmd.Int(cli.IntOpt{
+			Name:   "w workers",
+			Desc:   "The number of workers to use for uploading in parallel",
+			EnvVar: "WORKERS",
+			Value:  10,
+		}),
+		journalPath: cmd.String(cli.StringOpt{
+			Name:   "journal",
+			Desc:   "A file where to record every file successfully uploaded, as JSON lines",
+			EnvVar: "JOURNAL",
+		}),
+		resume: cmd.Bool(cli.BoolOpt{
+			Name:   "resume",
+			Desc:   "Skip the files already recorded in the journal with the same ID, size and SHA-256. Requires --journal",
+			EnvVar: "RESUME",
+			Value:  false,
+		}),
+		continueOnError: cmd.Bool(cli.BoolOpt{
+			Name:   "continue-on-error",
+			Desc:   "Carry on uploading the other files when a file fails, then write all the failures to the failure report",
+			EnvVar: "CONTINUE_ON_ERROR",
+			Value:  false,
+		}),
+		failureReportPath: cmd.String(cli.StringOpt{
+			Name:   "failure-report",
+			Desc:   "The file where to write the failures to, as JSON, when running with --continue-on-error",
+			EnvVar: "FAILURE_REPORT",
+			Value:  "failure-report.json",
+		}),
+		idOptions: addIDOptions(cmd),
+		previewIDs: cmd.Bool(cli.BoolOpt{
+			Name:   "preview-ids",
+			Desc:   "Only print the path and the archive ID of every file, separated by a tab, without uploading anything",
+			EnvVar: "PREVIEW_IDS",
+			Value:  false,
+		}),
+		dryRun: cmd.Bool(cli.BoolOpt{
+			Name:   "dry-run",
+			Desc:   "Run the whole upload without calling the fulfilment archive api, then print what would have been uploaded",
+			EnvVar: "DRY_RUN",
+			Value:  false,
+		}),
+		skipExisting: cmd.Bool(cli.BoolOpt{
+			Name:   "skip-existing",
+			Desc:   "Look up every file in the archive before uploading it, and skip the ones already archived",
+			EnvVar: "SKIP_EXISTING",
+			Value:  false,
+		}),
+		overwriteChanged: cmd.Bool(cli.BoolOpt{
+			Name:   "overwrite-changed",
+			Desc:   "Upload again the files already archived whose content changed, skipping only the identical ones. Requires --skip-existing",
+			EnvVar: "OVERWRITE_CHANGED",
+			Value:  false,
+		}),
+		runTimeout: cmd.String(cli.StringOpt{
+			Name:   "run-timeout",
+			Desc:   "Stop the upload, failing, once it has been running for longer than this. The files being uploaded then fail with a timeout. 0 means no limit",
+			EnvVar: "RUN_TIMEOUT",
+			Value:  "0s",
+		}),
+		maxRPS: cmd.String(cli.StringOpt{
+			Name:   "max-rps",
+			Desc:   "The maximum number of calls per second to the fulfilment archive api, across all the workers. 0 means no limit",
+			EnvVar: "MAX_RPS",
+			Value:  "0",
+		}),
+		maxBytesPerSec: cmd.Int(cli.IntOpt{
+			Name:   "max-bytes-per-sec",
+			Desc:   "The maximum number of bytes per second uploaded to the fulfilment archive api, across all the workers. 0 means no limit",
+			EnvVar: "MAX_BYTES_PER_SEC",
+			Value:  0,
+		}),
+		adaptive: cmd.Bool(cli.BoolOpt{
+			Name:   "adaptive-concurrency",
+			Desc:   "Vary the number of files uploaded at once between --min-workers and --workers, backing off when the fulfilment archive api is overloaded or slow",
+			EnvVar: "ADAPTIVE_CONCURRENCY",
+			Value:  false,
+		}),
+		minWorkers: cmd.Int(cli.IntOpt{
+			Name:   "min-workers",
+			Desc:   "The lowest, and initial, number of files uploaded at once with --adaptive-concurrency",
+			EnvVar: "MIN_WORKERS",
+			Value:  1,
+		}),
+		maxLatency: cmd.String(cli.StringOpt{
+			Name:   "adaptive-max-latency",
+			Desc:   "With --adaptive-concurrency, back off whenever an attempt to upload a file takes longer than this, per MiB for the files over 1 MiB. 0 means only backing off on ResourceExhausted and Unavailable errors",
+			EnvVar: "ADAPTIVE_MAX_LATENCY",
+			Value:  "5s",
+		}),
+		drainTimeout: cmd.String(cli.StringOpt{
+			Name:   "drain-timeout",
+			Desc:   "On SIGINT or SIGTERM, stop starting new files and give the ones being uploaded this long to complete, before cancelling them. 0 means waiting as long as they take. A second signal cancels them straight away",
+			EnvVar: "DRAIN_TIMEOUT",
+			Value:  "20s",
+		}),
+	}
+}
+
+// rateLimiter returns the limiter shared by all the workers, or nil when no limit is set.
+func (o *uploadOptions) rateLimiter() (*grpcclient.RateLimiter, error) {
+	maxRPS, err := strconv.ParseFloat(*o.maxRPS, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --max-rps: %w", err)
+	}
+	if maxRPS < 0 || *o.maxBytesPerSec < 0 {
+		return nil, errors.New("the rate limits cannot be negative")
+	}
+	if maxRPS == 0 && *o.maxBytesPerSec == 0 {
+		return nil, nil
+	}
+	log.Infof("Limiting the upload to %v calls per second and %d bytes per second, 0 meaning no limit", maxRPS, *o.maxBytesPerSec)
+	return grpcclient.NewRateLimiter(maxRPS, *o.maxBytesPerSec), nil
+}
+
+// redirectLogs sends the logs to stderr when stdout is used for the output of the command.
+func (o *uploadOptions) redirectLogs() {
+	if *o.previewIDs || *o.dryRun {
+		log.SetOutput(os.Stderr)
+	}
+}
+
+// idMapper returns the mapper configured by the id options, or nil if the files should be saved under their paths.
+func (o *idOptions) idMapper() (ffaac.IDMapper, error) {
+	var idMapper ffaac.IDMapper
+	if *o.idTemplate != "" || *o.idRegex != "" || *o.idPrefix != "" || *o.idStripPrefix != "" {
+		template := *o.idTemplate
+		if template == "" {
+			template = "{path}"
+		}
+		var err error
+		idMapper, err = ffaac.NewTemplateIDMapper(template, *o.idRegex, *o.idPrefix, *o.idStripPrefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if *o.idMap == "" {
+		return idMapper, nil
+	}
+
+	f, err := os.Open(*o.idMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening id map %s: %w", *o.idMap, err)
+	}
+	defer f.Close()
+
+	if idMapper == nil {
+		idMapper = ffaac.NewPathIDMapper()
+	}
+	tabSeparated := strings.EqualFold(filepath.Ext(*o.idMap), ".tsv")
+	return ffaac.NewCSVIDMapper(f, tabSeparated, idMapper, *o.idMapStrict)
+}
+
+func uploadCommand(cmd *cli.Cmd, dial dialFunc) {
+	finderOpts := addFinderOptions(cmd, "Upload")
+
+	basedir := cmd.String(cli.StringArg{
+		Name:   "BASEDIR",
+		Desc:   "The base directory where to upload all the files from",
+		EnvVar: "BASEDIR",
+	})
+
+	filesFrom := cmd.String(cli.StringOpt{
+		Name:   "files-from",
+		Desc:   "Upload only the files listed in this file, instead of walking BASEDIR. Use - to read the list from stdin",
+		EnvVar: "FILES_FROM",
+	})
+
+	nullSeparated := cmd.Bool(cli.BoolOpt{
+		Name:   "0 null",
+		Desc:   "The files in --files-from are separated by NUL characters, as printed by find -print0, instead of newlines",
+		EnvVar: "NULL_SEPARATED",
+		Value:  false,
+	})
+
+	opts := addUploadOptions(cmd)
+
+	cmd.Action = func() {
+		opts.redirectLogs()
+		log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
+
+		if *filesFrom == "" {
+			filesFinder, err := finderOpts.filesFinder(*basedir)
+			if err != nil {
+				log.WithError(err).Error("Got error while parsing the include and exclude patterns")
+				cli.Exit(exitCodeWithError)
+			}
+			runUpload(dial, opts, *basedir, filesFinder)
+			return
+		}
+
+		log.Infof("Starting processing files in %s listed in %s", *basedir, *filesFrom)
+
+		var manifest io.ReadCloser = os.Stdin
+		if *filesFrom != "-" {
+			f, err := os.Open(*filesFrom)
+			if err != nil {
+				log.WithError(err).Errorf("failed opening %s", *filesFrom)
+				cli.Exit(exitCodeWithError)
+			}
+			manifest = f
+		}
+		defer func() {
+			if err := manifest.Close(); err != nil {
+				log.WithError(err).Errorf("failed closing %s", *filesFrom)
+			}
+		}()
+
+		runUpload(dial, opts, *basedir, ffaac.NewManifestFilesFinder(*basedir, manifest, *nullSeparated))
+	}
+}
+
+// runUpload uploads all the files sent by filesFinder, exiting with an error code if the upload fails.
+func runUpload(dial dialFunc, opts *uploadOptions, basedir string, filesFinder ffaac.FilesFinder) {
+	if *opts.resume && *opts.journalPath == "" {
+		log.Error("--resume requires --journal")
+		cli.Exit(exitCodeWithError)
+	}
+	if *opts.overwriteChanged && !*opts.skipExisting {
+		log.Error("--overwrite-changed requires --skip-existing")
+		cli.Exit(exitCodeWithError)
+	}
+	if *opts.dryRun && *opts.skipExisting {
+		//	the dry run does not call the archive api, so it cannot tell which files are already archived
+		log.Error("--dry-run cannot be used with --skip-existing")
+		cli.Exit(exitCodeWithError)
+	}
+
+	runTimeout, err := parseDuration("run-timeout", *opts.runTimeout)
+	if err != nil {
+		log.WithError(err).Error("Got error while parsing the run timeout")
+		cli.Exit(exitCodeWithError)
+	}
+
+	var adaptiveMaxLatency time.Duration
+	if *opts.adaptive {
+		if *opts.minWorkers < 1 || *opts.minWorkers > *opts.workers {
+			log.Error("--min-workers must be between 1 and --workers")
+			cli.Exit(exitCodeWithError)
+		}
+		if adaptiveMaxLatency, err = parseDuration("adaptive-max-latency", *opts.maxLatency); err != nil {
+			log.WithError(err).Error("Got error while parsing the adaptive concurrency options")
+			cli.Exit(exitCodeWithError)
+		}
+	}
+
+	drainTimeout, err := parseDuration("drain-timeout", *opts.drainTimeout)
+	if err != nil {
+		log.WithError(err).Error("Got error while parsing the drain timeout")
+		cli.Exit(exitCodeWithError)
+	}
+
+	rateLimiter, err := opts.rateLimiter()
+	if err != nil {
+		log.WithError(err).Error("Got error while parsing the rate limits")
+		cli.Exit(exitCodeWithError)
+	}
+
+	idMapper, err := opts.idMapper()
+	if err != nil {
+		log.WithError(err).Error("Got error while parsing the id options")
+		cli.Exit(exitCodeWithError)
+	}
+
+	if *opts.previewIDs {
+		previewIDs(filesFinder, idMapper)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var faaClient bfaa.BillFulfilmentArchiveAPIClient
+	var dryRunClient *ffaac.DryRunArchiveAPIClient
+	if *opts.dryRun {
+		dryRunClient = ffaac.NewDryRunArchiveAPIClient()
+		faaClient = dryRunClient
+	} else {
+		//	waiting after the retries, so that every attempt counts against the rate limits
+		fulfilmentArchAPIConn := dial(ctx, grpcclient.RateLimitInterceptor(rateLimiter))
+		defer closeGRPCClientConnection(fulfilmentArchAPIConn)
+
+		faaClient = bfaa.NewBillFulfilmentArchiveAPIClient(fulfilmentArchAPIConn)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+
+	doneCh := make(chan bool)
+	defer close(doneCh)
+
+	var processorOpts []ffaac.ProcessorOption
+	if *opts.journalPath != "" {
+		openJournal := ffaac.OpenJournal
+		if *opts.dryRun {
+			//	a dry run only reads the journal, to plan a resume, as nothing gets saved
+			openJournal = ffaac.ReadJournal
+		}
+		journal, err := openJournal(*opts.journalPath)
+		if err != nil {
+			log.WithError(err).Error("Got error while opening the journal")
+			cli.Exit(exitCodeWithError)
+		}
+		defer func() {
+			if err := journal.Close(); err != nil {
+				log.WithError(err).Error("error while closing the journal")
+			}
+		}()
+		if !*opts.dryRun {
+			processorOpts = append(processorOpts, ffaac.WithJournal(journal))
+		}
+
+		if *opts.resume {
+			log.Infof("Resuming from journal %s, %d files already saved", *opts.journalPath, journal.Len())
+			filesFinder = ffaac.NewResumingFilesFinder(filesFinder, journal, basedir, idMapper)
+		}
+	}
+
+	if *opts.continueOnError {
+		processorOpts = append(processorOpts, ffaac.WithContinueOnError())
+	}
+	if idMapper != nil {
+		processorOpts = append(processorOpts, ffaac.WithIDMapper(idMapper))
+	}
+	if *opts.skipExisting {
+		processorOpts = append(processorOpts, ffaac.WithSkipExisting(*opts.overwriteChanged))
+	}
+	if runTimeout > 0 {
+		processorOpts = append(processorOpts, ffaac.WithRunTimeout(runTimeout))
+	}
+	if *opts.adaptive {
+		processorOpts = append(processorOpts, ffaac.WithAdaptiveConcurrency(*opts.minWorkers, adaptiveMaxLatency))
+	}
+
+	//	in the default registry, alongside the gRPC client metrics, for --metrics-addr and --metrics-textfile
+	metrics, err := ffaac.NewMetrics(prometheus.DefaultRegisterer)
+	if err != nil {
+		log.WithError(err).Error("Got error while registering the metrics")
+		cli.Exit(exitCodeWithError)
+	}
+	processorOpts = append(processorOpts, ffaac.WithMetrics(metrics))
+
+	filesProcessor := ffaac.NewFileProcessor(faaClient, basedir, *opts.workers, filesFinder, processorOpts...)
+
+	var procErr error
+	go func() {
+		procErr = filesProcessor.ProcessFiles(ctx)
+		doneCh <- true
+	}()
+
+	go func() {
+		if _, ok := <-sigChan; !ok {
+			return
+		}
+		log.Warnf("Stopping, waiting up to %v for the files being uploaded. Send the signal again to cancel them", drainTimeout)
+		filesProcessor.Drain(drainTimeout)
+
+		if _, ok := <-sigChan; !ok {
+			return
+		}
+		log.Warn("Stopping straight away, cancelling the files being uploaded")
+		//	cancel the context so that all processing should stop
+		cancel()
+	}()
+
+	//	wait for the processor to finish
+	<-doneCh
+	signal.Stop(sigChan)
+	close(sigChan)
+
+	if dryRunClient != nil {
+		if err := dryRunClient.Plan().Write(os.Stdout); err != nil {
+			log.WithError(err).Error("Got error while writing the dry run plan")
+			cli.Exit(exitCodeWithError)
+		}
+	}
+
+	if *opts.continueOnError {
+		report := filesProcessor.FailureReport()
+		if err := report.WriteFile(*opts.failureReportPath); err != nil {
+			log.WithError(err).Errorf("Got error while writing the failure report")
+			cli.Exit(exitCodeWithError)
+		}
+		if len(report.Failures) > 0 {
+			log.Errorf("%d files not uploaded, see %s", len(report.Failures), *opts.failureReportPath)
+		}
+	}
+
+	if procErr != nil {
+		log.WithError(procErr).Errorf("Got error while processing the files")
+		cli.Exit(exitCodeWithError)
+	}
+}
+
+// previewIDs prints the ID of every file sent by filesFinder, without connecting to the fulfilment archive api.
+func previewIDs(filesFinder ffaac.FilesFinder, idMapper ffaac.IDMapper) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	if idMapper == nil {
+		idMapper = ffaac.NewPathIDMapper()
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	err := ffaac.PreviewIDs(ctx, filesFinder, idMapper, w)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		log.WithError(err).Errorf("Got error while previewing the ids")
+		cli.Exit(exitCodeWithError)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	cli "github.com/jawher/mow.cli"
+	log "github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func verifyCommand(cmd *cli.Cmd, dial dialFunc) {
+	finderOpts := addFinderOptions(cmd, "Verify")
+
+	basedir := cmd.String(cli.StringArg{
+		Name:   "BASEDIR",
+		Desc:   "The base directory of the files to verify",
+		EnvVar: "BASEDIR",
+	})
+
+	workers := cmd.Int(cli.IntOpt{
+		Name:   "w workers",
+		Desc:   "The number of workers to use for verifying in parallel",
+		EnvVar: "WORKERS",
+		Value:  10,
+	})
+
+	compareSHA256 := cmd.Bool(cli.BoolOpt{
+		Name:   "sha256",
+		Desc:   "Compare the files with the archives by their SHA-256 digests, reporting them for the mismatched files, instead of byte by byte",
+		EnvVar: "SHA256",
+		Value:  false,
+	})
+
+	idOpts := addIDOptions(cmd)
+
+	cmd.Action = func() {
+		//	keep stdout clean for the report
+		log.SetOutput(os.Stderr)
+		log.Infof("finance-fulfilment-archive-api-cli version: %s", version)
+
+		filesFinder, err := finderOpts.filesFinder(*basedir)
+		if err != nil {
+			log.WithError(err).Error("Got error while parsing the include and exclude patterns")
+			cli.Exit(exitCodeWithError)
+		}
+
+		idMapper, err := idOpts.idMapper()
+		if err != nil {
+			log.WithError(err).Error("Got error while parsing the id options")
+			cli.Exit(exitCodeWithError)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		fulfilmentArchAPIConn := dial(ctx)
+		defer closeGRPCClientConnection(fulfilmentArchAPIConn)
+
+		verifier := ffaac.NewArchiveVerifier(bfaa.NewBillFulfilmentArchiveAPIClient(fulfilmentArchAPIConn), *basedir, *workers,
+			filesFinder, idMapper, *compareSHA256)
+		report, err := verifier.Verify(ctx)
+		if err != nil {
+			log.WithError(err).Error("Got error while verifying the files")
+			cli.Exit(exitCodeWithError)
+		}
+
+		w := bufio.NewWriter(os.Stdout)
+		err = report.Write(w)
+		if flushErr := w.Flush(); err == nil {
+			err = flushErr
+		}
+		if err != nil {
+			log.WithError(err).Error("Got error while writing the verify report")
+			cli.Exit(exitCodeWithError)
+		}
+
+		if n := report.Discrepancies(); n > 0 {
+			log.Errorf("%d of %d files are missing from the archive or differ from it", n, len(report.Files))
+			cli.Exit(exitCodeWithDiscrepancies)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package ffaac
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ArchiveDeleter removes the archives stored under a list of keys (IDs, account numbers or request IDs).
+// In dry run mode nothing is deleted, the archives which would be deleted are only looked up and logged.
+type ArchiveDeleter struct {
+	fetch   archiveFetchFunc
+	delete  func(ctx context.Context, key string) error
+	keyName string
+	workers int
+	dryRun  bool
+
+	deleted  int64
+	notFound int64
+}
+
+// NewArchiveDeleter returns a deleter which removes archives by ID.
+func NewArchiveDeleter(faaClient bfaa.BillFulfilmentArchiveAPIClient, workers int, dryRun bool) *ArchiveDeleter {
+	return &ArchiveDeleter{
+		fetch: func(ctx context.Context, id string) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+			return faaClient.GetBillFulfilmentArchive(ctx, &bfaa.GetBillFulfilmentArchiveRequest{Id: id})
+		},
+		delete: func(ctx context.Context, id string) error {
+			_, err := faaClient.DeleteBillFulfilmentArchive(ctx, &bfaa.DeleteBillFulfilmentArchiveRequest{Id: id})
+			return err
+		},
+		keyName: "id",
+		workers: workers,
+		dryRun:  dryRun,
+	}
+}
+
+// NewAccountArchiveDeleter returns a deleter which removes archives by account number.
+func NewAccountArchiveDeleter(faaClient bfaa.BillFulfilmentArchiveAPIClient, workers int, dryRun bool) *ArchiveDeleter {
+	return &ArchiveDeleter{
+		fetch: func(ctx context.Context, accountNumber string) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+			return faaClient.GetBillFulfilmentArchiveByAccountNumber(ctx, &bfaa.GetBillFulfilmentArchiveByAccountNumberRequest{AccountNumber: accountNumber})
+		},
+		delete: func(ctx context.Context, accountNumber string) error {
+			_, err := faaClient.DeleteBillFulfilmentArchiveByAccountNumber(ctx, &bfaa.DeleteBillFulfilmentArchiveByAccountNumberRequest{AccountNumber: accountNumber})
+			return err
+		},
+		keyName: "account_number",
+		workers: workers,
+		dryRun:  dryRun,
+	}
+}
+
+// NewRequestIDArchiveDeleter returns a deleter which removes archives by fulfilment request ID.
+func NewRequestIDArchiveDeleter(faaClient bfaa.BillFulfilmentArchiveAPIClient, workers int, dryRun bool) *ArchiveDeleter {
+	return &ArchiveDeleter{
+		fetch: func(ctx context.Context, requestID string) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+			return faaClient.GetBillFulfilmentArchiveByRequestID(ctx, &bfaa.GetBillFulfilmentArchiveByRequestIDRequest{RequestId: requestID})
+		},
+		delete: func(ctx context.Context, requestID string) error {
+			_, err := faaClient.DeleteBillFulfilmentArchiveByRequestID(ctx, &bfaa.DeleteBillFulfilmentArchiveByRequestIDRequest{RequestId: requestID})
+			return err
+		},
+		keyName: "request_id",
+		workers: workers,
+		dryRun:  dryRun,
+	}
+}
+
+// Delete removes the archives for all the keys sent by keysReader, stopping at the first error.
+func (d *ArchiveDeleter) Delete(ctx context.Context, keysReader KeysReader) error {
+	if err := processKeys(ctx, keysReader, d.workers, d.deleteKey); err != nil {
+		return err
+	}
+
+	if d.dryRun {
+		logrus.Infof("Dry run: %d archives would be deleted, %d not found", d.deleted, d.notFound)
+	} else {
+		logrus.Infof("Deleted %d archives, %d not found", d.deleted, d.notFound)
+	}
+	return nil
+}
+
+func (d *ArchiveDeleter) deleteKey(ctx context.Context, key string) error {
+	if d.dryRun {
+		resp, err := d.fetch(ctx, key)
+		if status.Code(err) == codes.NotFound {
+			atomic.AddInt64(&d.notFound, 1)
+			logrus.Warnf("Dry run: no archive found for %s %s", d.keyName, key)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed calling the fulfilment archive api for %s %s: %w", d.keyName, key, err)
+		}
+		atomic.AddInt64(&d.deleted, 1)
+		logrus.Infof("Dry run: would delete archive for %s %s (%d bytes)", d.keyName, key, len(resp.GetArchive().GetData()))
+		return nil
+	}
+
+	err := d.delete(ctx, key)
+	if status.Code(err) == codes.NotFound {
+		atomic.AddInt64(&d.notFound, 1)
+		logrus.Warnf("No archive found for %s %s", d.keyName, key)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed deleting archive for %s %s: %w", d.keyName, key, err)
+	}
+	atomic.AddInt64(&d.deleted, 1)
+	logrus.Infof("Deleted archive for %s %s", d.keyName, key)
+	return nil
+}
+
+// Counts returns the number of archives deleted (or which would be deleted in dry run mode) and not found so far.
+func (d *ArchiveDeleter) Counts() (deleted int, notFound int) {
+	return int(atomic.LoadInt64(&d.deleted)), int(atomic.LoadInt64(&d.notFound))
+}
@@ -0,0 +1,103 @@
+package ffaac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac/mocks"
+)
+
+func TestDeleteManyIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	var ids []string
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("fold1/file%d.pdf", i)
+		ids = append(ids, id)
+		mockArchiveAPIClient.EXPECT().DeleteBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.DeleteBillFulfilmentArchiveRequest{Id: id})).Return(nil, nil).Times(1)
+	}
+	mockArchiveAPIClient.EXPECT().DeleteBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.DeleteBillFulfilmentArchiveRequest{Id: "missing"})).
+		Return(nil, status.Error(codes.NotFound, "not found")).Times(1)
+	ids = append(ids, "missing")
+
+	deleter := ffaac.NewArchiveDeleter(mockArchiveAPIClient, workers, false)
+	err := deleter.Delete(context.Background(), ffaac.KeysFromReader(strings.NewReader(strings.Join(ids, "\n"))))
+	require.NoError(t, err)
+
+	deleted, notFound := deleter.Counts()
+	assert.Equal(t, 100, deleted)
+	assert.Equal(t, 1, notFound)
+}
+
+func TestDeleteAccountDryRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByAccountNumber(gomock.Any(), ProtoMatcher(&bfaa.GetBillFulfilmentArchiveByAccountNumberRequest{AccountNumber: "123"})).
+		DoAndReturn(accountArchiveResponse).Times(1)
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByAccountNumber(gomock.Any(), ProtoMatcher(&bfaa.GetBillFulfilmentArchiveByAccountNumberRequest{AccountNumber: "456"})).
+		Return(nil, status.Error(codes.NotFound, "not found")).Times(1)
+	mockArchiveAPIClient.EXPECT().DeleteBillFulfilmentArchiveByAccountNumber(gomock.Any(), gomock.Any()).Times(0)
+
+	deleter := ffaac.NewAccountArchiveDeleter(mockArchiveAPIClient, workers, true)
+	err := deleter.Delete(context.Background(), ffaac.KeysFromList("123", "456"))
+	require.NoError(t, err)
+
+	deleted, notFound := deleter.Counts()
+	assert.Equal(t, 1, deleted)
+	assert.Equal(t, 1, notFound)
+}
+
+func TestDeleteRequestIDError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	apiErr := errors.New("dummy error")
+	mockArchiveAPIClient.EXPECT().DeleteBillFulfilmentArchiveByRequestID(gomock.Any(), ProtoMatcher(&bfaa.DeleteBillFulfilmentArchiveByRequestIDRequest{RequestId: "run-1"})).
+		Return(nil, apiErr).Times(1)
+
+	deleter := ffaac.NewRequestIDArchiveDeleter(mockArchiveAPIClient, workers, false)
+	err := deleter.Delete(context.Background(), ffaac.KeysFromList("run-1"))
+	assert.True(t, errors.Is(err, apiErr))
+}
+
+func TestDeleteInterrupted(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	var ids []string
+	for i := 0; i < 100; i++ {
+		ids = append(ids, fmt.Sprintf("fold1/file%d.pdf", i))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	//	interrupted during the first deletes, which complete
+	mockArchiveAPIClient.EXPECT().DeleteBillFulfilmentArchive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(context.Context, *bfaa.DeleteBillFulfilmentArchiveRequest, ...grpc.CallOption) (*emptypb.Empty, error) {
+			cancel()
+			return &emptypb.Empty{}, nil
+		}).MinTimes(1).MaxTimes(len(ids) - 1)
+
+	deleter := ffaac.NewArchiveDeleter(mockArchiveAPIClient, workers, false)
+	err := deleter.Delete(ctx, ffaac.KeysFromList(ids...))
+	assert.True(t, errors.Is(err, context.Canceled))
+}
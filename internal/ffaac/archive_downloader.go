@@ -0,0 +1,78 @@
+package ffaac
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+)
+
+// ArchiveDownloader retrieves archives from the fulfilment archive api and writes their content out.
+type ArchiveDownloader struct {
+	archiveAPIClient bfaa.BillFulfilmentArchiveAPIClient
+}
+
+func NewArchiveDownloader(faaClient bfaa.BillFulfilmentArchiveAPIClient) *ArchiveDownloader {
+	return &ArchiveDownloader{
+		archiveAPIClient: faaClient,
+	}
+}
+
+// Download writes the data of the archive with the given id to w.
+func (d *ArchiveDownloader) Download(ctx context.Context, id string, w io.Writer) error {
+	resp, err := d.archiveAPIClient.GetBillFulfilmentArchive(ctx, &bfaa.GetBillFulfilmentArchiveRequest{Id: id})
+	if err != nil {
+		return fmt.Errorf("failed calling the fulfilment archive api for id %s: %w", id, err)
+	}
+
+	if _, err := w.Write(resp.GetArchive().GetData()); err != nil {
+		return fmt.Errorf("failed writing data for id %s: %w", id, err)
+	}
+	return nil
+}
+
+// DownloadToFile writes the data of the archive with the given id to the file at path.
+// The file only appears at path once it has been fully written.
+func (d *ArchiveDownloader) DownloadToFile(ctx context.Context, id string, path string) error {
+	resp, err := d.archiveAPIClient.GetBillFulfilmentArchive(ctx, &bfaa.GetBillFulfilmentArchiveRequest{Id: id})
+	if err != nil {
+		return fmt.Errorf("failed calling the fulfilment archive api for id %s: %w", id, err)
+	}
+	return writeFileAtomically(path, resp.GetArchive().GetData())
+}
+
+func writeFileAtomically(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("failed creating dir %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed creating temporary file for %s: %w", path, err)
+	}
+	defer func() {
+		// no-op once the file has been renamed
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed writing file %s: %w", path, err)
+	}
+	//	CreateTemp makes the file readable by its owner only, the archives are readable by all as when written directly
+	if err := tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed setting the mode of file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed closing file %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed moving file into %s: %w", path, err)
+	}
+	return nil
+}
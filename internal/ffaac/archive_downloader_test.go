@@ -0,0 +1,70 @@
+package ffaac_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac/mocks"
+)
+
+func TestDownload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.GetBillFulfilmentArchiveRequest{Id: "fold1/one.pdf"})).
+		Return(&bfaa.GetBillFulfilmentArchiveResponse{Archive: &bfaa.BillFulfilmentArchive{Data: []byte("content")}}, nil).Times(1)
+
+	var buf bytes.Buffer
+	err := ffaac.NewArchiveDownloader(mockArchiveAPIClient).Download(context.Background(), "fold1/one.pdf", &buf)
+	require.NoError(t, err)
+	assert.Equal(t, "content", buf.String())
+}
+
+func TestDownloadToFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), gomock.Any()).
+		Return(&bfaa.GetBillFulfilmentArchiveResponse{Archive: &bfaa.BillFulfilmentArchive{Data: []byte("content")}}, nil).Times(1)
+
+	outFile := filepath.Join(t.TempDir(), "fold1", "one.pdf")
+	err := ffaac.NewArchiveDownloader(mockArchiveAPIClient).DownloadToFile(context.Background(), "one", outFile)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, "content", string(data))
+
+	info, err := os.Stat(outFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+}
+
+func TestDownloadToFileError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	apiErr := errors.New("dummy error")
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), gomock.Any()).Return(nil, apiErr).Times(1)
+
+	outDir := t.TempDir()
+	err := ffaac.NewArchiveDownloader(mockArchiveAPIClient).DownloadToFile(context.Background(), "one", filepath.Join(outDir, "one.pdf"))
+	assert.True(t, errors.Is(err, apiErr))
+
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
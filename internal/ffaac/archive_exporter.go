@@ -0,0 +1,223 @@
+package ffaac
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IndexFileName is the name of the file, written in the output dir of an export, listing all the exported archives.
+const IndexFileName = "index.csv"
+
+type archiveFetchFunc func(ctx context.Context, key string) (*bfaa.GetBillFulfilmentArchiveResponse, error)
+
+// ArchiveExporter downloads the archives stored under a list of keys (e.g. account numbers) into a directory.
+type ArchiveExporter struct {
+	fetch    archiveFetchFunc
+	keyName  string
+	fileName func(key string) string
+	outDir   string
+	workers  int
+	// nested is set when the files are laid out in dirs following the keys
+	nested bool
+
+	mu      sync.Mutex
+	entries []indexEntry
+}
+
+type indexEntry struct {
+	key  string
+	file string
+	size int
+}
+
+// NewAccountArchiveExporter returns an exporter which downloads the archives of account numbers.
+func NewAccountArchiveExporter(faaClient bfaa.BillFulfilmentArchiveAPIClient, outDir string, workers int) *ArchiveExporter {
+	return &ArchiveExporter{
+		fetch: func(ctx context.Context, accountNumber string) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+			return faaClient.GetBillFulfilmentArchiveByAccountNumber(ctx, &bfaa.GetBillFulfilmentArchiveByAccountNumberRequest{AccountNumber: accountNumber})
+		},
+		keyName:  "account_number",
+		fileName: sanitiseFileName,
+		outDir:   outDir,
+		workers:  workers,
+	}
+}
+
+// NewRequestIDArchiveExporter returns an exporter which downloads the archives produced by fulfilment requests.
+// The files are laid out in the output dir following the request IDs, so that IDs like 2023/01/run-1 end up nested.
+func NewRequestIDArchiveExporter(faaClient bfaa.BillFulfilmentArchiveAPIClient, outDir string, workers int) *ArchiveExporter {
+	return &ArchiveExporter{
+		fetch: func(ctx context.Context, requestID string) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+			return faaClient.GetBillFulfilmentArchiveByRequestID(ctx, &bfaa.GetBillFulfilmentArchiveByRequestIDRequest{RequestId: requestID})
+		},
+		keyName:  "request_id",
+		fileName: mirroredFileName,
+		nested:   true,
+		outDir:   outDir,
+		workers:  workers,
+	}
+}
+
+// Export downloads the archives for all the keys sent by keysReader, then writes the index file.
+// The index is written also when the export fails, listing the archives written so far.
+// When the files are nested following the keys, all the keys are read first, failing before downloading anything
+// if the file of a key would be where another key needs a dir.
+func (e *ArchiveExporter) Export(ctx context.Context, keysReader KeysReader) error {
+	if e.nested {
+		keys, err := readAllKeys(ctx, keysReader)
+		if err != nil {
+			return err
+		}
+		if err := e.checkNestedFileNames(keys); err != nil {
+			return err
+		}
+		keysReader = KeysFromList(keys...)
+	}
+
+	procErr := processKeys(ctx, keysReader, e.workers, e.exportKey)
+	if err := e.writeIndex(); err != nil {
+		if procErr != nil {
+			logrus.WithError(err).Error("failed writing the export index")
+			return procErr
+		}
+		return err
+	}
+	if procErr != nil {
+		return procErr
+	}
+
+	logrus.Infof("Exported %d archives to %s", len(e.entries), e.outDir)
+	return nil
+}
+
+func (e *ArchiveExporter) exportKey(ctx context.Context, key string) error {
+	logrus.Infof("Exporting %s %s", e.keyName, key)
+	resp, err := e.fetch(ctx, key)
+	if status.Code(err) == codes.NotFound {
+		logrus.Warnf("No archive found for %s %s", e.keyName, key)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed calling the fulfilment archive api for %s %s: %w", e.keyName, key, err)
+	}
+
+	data := resp.GetArchive().GetData()
+	fileName := e.fileName(key)
+	if err := writeFileAtomically(filepath.Join(e.outDir, fileName), data); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.entries = append(e.entries, indexEntry{key: key, file: filepath.ToSlash(fileName), size: len(data)})
+	return nil
+}
+
+// checkNestedFileNames fails if the file of a key is a dir of the file of another key, as for a and a/b,
+// or of the index file, as only the first one written of the two could then be.
+func (e *ArchiveExporter) checkNestedFileNames(keys []string) error {
+	fileNames := make(map[string]string, len(keys))
+	dirs := make(map[string]string)
+	for _, key := range keys {
+		fileName := filepath.ToSlash(e.fileName(key))
+		fileNames[key] = fileName
+		for dir := path.Dir(fileName); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = key
+		}
+	}
+
+	if other, ok := dirs[IndexFileName]; ok {
+		return fmt.Errorf("%s %s cannot be exported, it needs a dir where the index file is written", e.keyName, other)
+	}
+	for _, key := range keys {
+		if other, ok := dirs[fileNames[key]]; ok {
+			return fmt.Errorf("%s %s and %s cannot be exported together, %s would be both a file and a dir",
+				e.keyName, key, other, fileNames[key])
+		}
+	}
+	return nil
+}
+
+func (e *ArchiveExporter) writeIndex() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	sort.Slice(e.entries, func(i, j int) bool {
+		return e.entries[i].key < e.entries[j].key
+	})
+
+	var sb strings.Builder
+	w := csv.NewWriter(&sb)
+	_ = w.Write([]string{e.keyName, "file", "size"})
+	for _, entry := range e.entries {
+		_ = w.Write([]string{entry.key, entry.file, strconv.Itoa(entry.size)})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("failed building the export index: %w", err)
+	}
+
+	return writeFileAtomically(filepath.Join(e.outDir, IndexFileName), []byte(sb.String()))
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// sanitiseFileName maps a key to a file name which is the same on every run and safe on every OS.
+// The keys which had to be changed get a hash of the key appended, so that no two keys get the same name.
+func sanitiseFileName(key string) string {
+	name := unsafeFileNameChars.ReplaceAllString(key, "_")
+	if name == "" || name == "." || name == ".." || name == IndexFileName {
+		name = "_" + name
+	}
+	if name != key {
+		name = withKeyHash(name, key)
+	}
+	return name
+}
+
+// withKeyHash appends a short hash of key to the file name it was changed into.
+func withKeyHash(name string, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return name + "-" + hex.EncodeToString(sum[:4])
+}
+
+// mirroredFileName maps a key to a relative file path following its / separated segments,
+// making sure that the path cannot point outside of the output dir, and that no two keys get the same path.
+func mirroredFileName(key string) string {
+	var segments []string
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "", ".":
+			continue
+		case "..":
+			segment = "_.."
+		}
+		segments = append(segments, strings.ReplaceAll(segment, `\`, "_"))
+	}
+	if len(segments) == 0 {
+		return sanitiseFileName(key)
+	}
+
+	if len(segments) == 1 && segments[0] == IndexFileName {
+		segments[0] = "_" + IndexFileName
+	}
+	if strings.Join(segments, "/") != key {
+		segments[len(segments)-1] = withKeyHash(segments[len(segments)-1], key)
+	}
+	return filepath.Join(segments...)
+}
@@ -0,0 +1,197 @@
+package ffaac_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac/mocks"
+)
+
+func accountArchiveResponse(ctx context.Context, in *bfaa.GetBillFulfilmentArchiveByAccountNumberRequest, opts ...grpc.CallOption) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+	return &bfaa.GetBillFulfilmentArchiveResponse{Archive: &bfaa.BillFulfilmentArchive{Data: []byte("bill " + in.AccountNumber)}}, nil
+}
+
+func TestExportAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByAccountNumber(gomock.Any(), ProtoMatcher(&bfaa.GetBillFulfilmentArchiveByAccountNumberRequest{AccountNumber: "123/45"})).
+		DoAndReturn(accountArchiveResponse).Times(1)
+
+	outDir := t.TempDir()
+	exporter := ffaac.NewAccountArchiveExporter(mockArchiveAPIClient, outDir, workers)
+	err := exporter.Export(context.Background(), ffaac.KeysFromList("123/45"))
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(filepath.Join(outDir, "123_45-55e65188"))
+	require.NoError(t, err)
+	assert.Equal(t, "bill 123/45", string(data))
+
+	index, err := os.ReadFile(filepath.Join(outDir, ffaac.IndexFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "account_number,file,size\n123/45,123_45-55e65188,11\n", string(index))
+}
+
+func TestExportAccountsSanitisedAlike(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByAccountNumber(gomock.Any(), gomock.Any()).
+		DoAndReturn(accountArchiveResponse).Times(3)
+
+	outDir := t.TempDir()
+	exporter := ffaac.NewAccountArchiveExporter(mockArchiveAPIClient, outDir, workers)
+	err := exporter.Export(context.Background(), ffaac.KeysFromList("123/45", "123_45", "123 45"))
+	require.NoError(t, err)
+
+	index, err := os.ReadFile(filepath.Join(outDir, ffaac.IndexFileName))
+	require.NoError(t, err)
+	records, err := csv.NewReader(bytes.NewReader(index)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4)
+
+	files := make(map[string]bool)
+	for _, record := range records[1:] {
+		assert.False(t, files[record[1]], "%s written to %s too", record[0], record[1])
+		files[record[1]] = true
+
+		data, err := os.ReadFile(filepath.Join(outDir, record[1]))
+		require.NoError(t, err)
+		assert.Equal(t, "bill "+record[0], string(data))
+	}
+	assert.True(t, files["123_45"], "the safe account numbers keep their names")
+}
+
+func TestExportManyAccountsFromReader(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	var lines []string
+	var expectedIndex []string
+	for i := 0; i < 50; i++ {
+		lines = append(lines, fmt.Sprintf("acc%02d", i))
+		expectedIndex = append(expectedIndex, fmt.Sprintf("acc%02d,acc%02d,10", i, i))
+	}
+	// duplicates, comments and blank lines are skipped
+	lines = append(lines, "acc01", "", "# comment", "  acc02  ")
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByAccountNumber(gomock.Any(), gomock.Any()).
+		DoAndReturn(accountArchiveResponse).Times(50)
+
+	outDir := t.TempDir()
+	exporter := ffaac.NewAccountArchiveExporter(mockArchiveAPIClient, outDir, workers)
+	err := exporter.Export(context.Background(), ffaac.KeysFromReader(strings.NewReader(strings.Join(lines, "\n"))))
+	require.NoError(t, err)
+
+	index, err := os.ReadFile(filepath.Join(outDir, ffaac.IndexFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "account_number,file,size\n"+strings.Join(expectedIndex, "\n")+"\n", string(index))
+}
+
+func TestExportAccountNotFound(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByAccountNumber(gomock.Any(), gomock.Any()).
+		Return(nil, status.Error(codes.NotFound, "not found")).Times(1)
+
+	outDir := t.TempDir()
+	exporter := ffaac.NewAccountArchiveExporter(mockArchiveAPIClient, outDir, workers)
+	err := exporter.Export(context.Background(), ffaac.KeysFromList("123"))
+	require.NoError(t, err)
+
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, ffaac.IndexFileName, entries[0].Name())
+}
+
+func TestExportAccountError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	apiErr := errors.New("dummy error")
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByAccountNumber(gomock.Any(), gomock.Any()).
+		Return(nil, apiErr).Times(1)
+
+	exporter := ffaac.NewAccountArchiveExporter(mockArchiveAPIClient, t.TempDir(), 1)
+	err := exporter.Export(context.Background(), ffaac.KeysFromList("123"))
+	assert.True(t, errors.Is(err, apiErr))
+}
+
+func TestExportRequestIDs(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+	mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchiveByRequestID(gomock.Any(), gomock.Any()).AnyTimes().DoAndReturn(
+		func(ctx context.Context, in *bfaa.GetBillFulfilmentArchiveByRequestIDRequest, opts ...grpc.CallOption) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+			return &bfaa.GetBillFulfilmentArchiveResponse{Archive: &bfaa.BillFulfilmentArchive{Data: []byte(in.RequestId)}}, nil
+		})
+
+	outDir := t.TempDir()
+	exporter := ffaac.NewRequestIDArchiveExporter(mockArchiveAPIClient, outDir, workers)
+	err := exporter.Export(context.Background(), ffaac.KeysFromList("run-1", "2023/01/run-2", "../../escape", "_../_../escape"))
+	require.NoError(t, err)
+
+	for id, fileName := range map[string]string{
+		"run-1":          "run-1",
+		"2023/01/run-2":  filepath.Join("2023", "01", "run-2"),
+		"../../escape":   filepath.Join("_..", "_..", "escape-efbf103b"),
+		"_../_../escape": filepath.Join("_..", "_..", "escape"),
+	} {
+		data, err := os.ReadFile(filepath.Join(outDir, fileName))
+		require.NoError(t, err)
+		assert.Equal(t, id, string(data))
+	}
+
+	index, err := os.ReadFile(filepath.Join(outDir, ffaac.IndexFileName))
+	require.NoError(t, err)
+	assert.Equal(t, "request_id,file,size\n../../escape,_../_../escape-efbf103b,12\n2023/01/run-2,2023/01/run-2,13\n_../_../escape,_../_../escape,14\nrun-1,run-1,5\n", string(index))
+}
+
+func TestExportRequestIDsNestedInEachOther(t *testing.T) {
+	for name, keys := range map[string][]string{
+		"file first":  {"2023/run-1", "2023/run-1/retry"},
+		"dir first":   {"2023/run-1/retry", "2023/run-1"},
+		"index dir":   {"run-1", "index.csv/run-2"},
+		"deeper file": {"a", "a/b/c/d"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockArchiveAPIClient := mocks.NewMockBillFulfilmentArchiveAPIClient(ctrl)
+
+			outDir := t.TempDir()
+			exporter := ffaac.NewRequestIDArchiveExporter(mockArchiveAPIClient, outDir, workers)
+			err := exporter.Export(context.Background(), ffaac.KeysFromList(keys...))
+			assert.Error(t, err)
+
+			//	nothing downloaded
+			entries, err := os.ReadDir(outDir)
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package ffaac
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// DefaultIgnoreFileName is the name of the files listing, with the gitignore syntax, the files never to be archived.
+const DefaultIgnoreFileName = ".archiveignore"
+
+// ignoreFile holds the rules of an ignore file, which apply to the files in its dir and below.
+type ignoreFile struct {
+	// the / separated base relative dir of the ignore file, empty for the base dir itself
+	dir   string
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// readIgnoreFile parses the ignore file at path, found in the base relative dir.
+func readIgnoreFile(path string, dir string) (*ignoreFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	ignore := &ignoreFile{dir: filepath.ToSlash(dir)}
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		rule, ok := parseIgnoreRule(scanner.Text())
+		if !ok {
+			continue
+		}
+		if !doublestar.ValidatePattern(rule.pattern) {
+			return nil, fmt.Errorf("invalid pattern at line %d of ignore file %s", lineNo, path)
+		}
+		ignore.rules = append(ignore.rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed reading ignore file %s: %w", path, err)
+	}
+	return ignore, nil
+}
+
+// parseIgnoreRule parses a line of an ignore file, following the gitignore syntax.
+func parseIgnoreRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " \t")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	var rule ignoreRule
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// a separator at the beginning or in the middle makes the pattern relative to the ignore file dir,
+	// otherwise it matches at any level below it
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	rule.pattern = line
+	return rule, true
+}
+
+// match returns whether the rule matches the / separated path, relative to the ignore file dir.
+func (r ignoreRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	pattern := r.pattern
+	if !r.anchored {
+		pattern = "**/" + pattern
+	}
+	// the pattern has been validated, so Match cannot fail
+	ok, _ := doublestar.Match(pattern, path)
+	return ok
+}
+
+// isIgnored tells whether the base relative path is ignored by the given ignore files, ordered from the outermost.
+// As with gitignore, the last matching rule wins, and the rules of the deeper files take precedence.
+func isIgnored(ignores []*ignoreFile, path string, isDir bool) bool {
+	path = filepath.ToSlash(path)
+
+	ignored := false
+	for _, ignore := range ignores {
+		rel := path
+		if ignore.dir != "" {
+			if !strings.HasPrefix(path, ignore.dir+"/") {
+				continue
+			}
+			rel = strings.TrimPrefix(path, ignore.dir+"/")
+		}
+		for _, rule := range ignore.rules {
+			if rule.match(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
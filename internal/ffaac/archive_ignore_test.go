@@ -0,0 +1,81 @@
+package ffaac_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestProcessHonoursIgnoreFiles(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	includedFiles := []string{
+		"one.pdf",
+		"keep.work.pdf",
+		filepath.Join("fold1", "two.pdf"),
+		filepath.Join("fold1", "build", "three.pdf"),
+		filepath.Join("fold2", "scratch.pdf"),
+	}
+	excludedFiles := []string{
+		"scratch.pdf",
+		"a.work.pdf",
+		filepath.Join("fold1", "b.work.pdf"),
+		filepath.Join("fold1", "deep", "c.work.pdf"),
+		filepath.Join("build", "five.pdf"),
+		filepath.Join("fold2", "nested", "build", "four.pdf"),
+		filepath.Join("fold2", "nested", "output", "six.pdf"),
+		filepath.Join("fold2", "nested", "output", "sub", "seven.pdf"),
+		filepath.Join("fold2", "nested", "notes.pdf"),
+	}
+	ti.createTestFiles(t, append(includedFiles, excludedFiles...)...)
+
+	ti.writeIgnoreFile(t, "", `# working files
+*.work.pdf
+!keep.work.pdf
+/scratch.pdf
+build/
+`)
+	ti.writeIgnoreFile(t, "fold2", `output/
+nested/notes.pdf
+`)
+	// a nested file can re-include what a parent one excludes, but only for its own subtree
+	ti.writeIgnoreFile(t, "fold1", `!build/`)
+
+	for _, fileName := range includedFiles {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf", "archiveignore"}, ffaac.WithIgnoreFiles(ffaac.DefaultIgnoreFileName))
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder)
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
+
+func TestProcessIgnoreFilesDisabled(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", filepath.Join("fold1", "two.pdf")}
+	ti.createTestFiles(t, fileNames...)
+	ti.writeIgnoreFile(t, "", "*.pdf\n")
+
+	for _, fileName := range fileNames {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder)
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
+
+func (ti *processorTestInstances) writeIgnoreFile(t *testing.T, dir string, content string) {
+	err := os.WriteFile(filepath.Join(ti.basedir, dir, ffaac.DefaultIgnoreFileName), []byte(content), 0666)
+	require.NoError(t, err)
+}
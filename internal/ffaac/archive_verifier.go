@@ -0,0 +1,198 @@
+package ffaac
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/codes"
+)
+
+// The statuses of a verified file.
+const (
+	VerifyStatusMatching   = "matching"
+	VerifyStatusMissing    = "missing"
+	VerifyStatusMismatched = "mismatched"
+)
+
+// ArchiveVerifier compares the local files with the archives saved under their IDs.
+type ArchiveVerifier struct {
+	archiveAPIClient bfaa.BillFulfilmentArchiveAPIClient
+	basedir          string
+	workers          int
+	filesFinder      FilesFinder
+	idMapper         IDMapper
+	compareSHA256    bool
+}
+
+// NewArchiveVerifier returns a verifier for the files sent by filesFinder. A nil idMapper uses the base relative paths
+// as IDs, as when uploading. With compareSHA256 the files are compared by their SHA-256 digests, which are reported
+// for the mismatched ones, rather than byte by byte.
+func NewArchiveVerifier(faaClient bfaa.BillFulfilmentArchiveAPIClient, basedir string, workers int, filesFinder FilesFinder,
+	idMapper IDMapper, compareSHA256 bool,
+) *ArchiveVerifier {
+	if idMapper == nil {
+		idMapper = pathIDMapper{}
+	}
+	return &ArchiveVerifier{
+		archiveAPIClient: faaClient,
+		basedir:          basedir,
+		workers:          workers,
+		filesFinder:      filesFinder,
+		idMapper:         idMapper,
+		compareSHA256:    compareSHA256,
+	}
+}
+
+// VerifiedFile is the outcome of the verification of a file.
+type VerifiedFile struct {
+	Path          string
+	ID            string
+	Status        string
+	Size          int
+	ArchiveSize   int
+	SHA256        string
+	ArchiveSHA256 string
+}
+
+// VerifyReport lists all the verified files, sorted by path.
+type VerifyReport struct {
+	Files []VerifiedFile
+}
+
+// Count returns the number of files with the given status.
+func (r *VerifyReport) Count(status string) int {
+	n := 0
+	for _, file := range r.Files {
+		if file.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// Discrepancies returns the number of files which are missing from the archive or differ from it.
+func (r *VerifyReport) Discrepancies() int {
+	return len(r.Files) - r.Count(VerifyStatusMatching)
+}
+
+// Write prints a line for every file, with its status, path and ID separated by tabs, followed by the sizes,
+// or the SHA-256 digests when known, of the file and of the archive for the mismatched ones.
+func (r *VerifyReport) Write(w io.Writer) error {
+	ew := &errWriter{w: w}
+	for _, file := range r.Files {
+		switch {
+		case file.Status != VerifyStatusMismatched:
+			ew.printf("%s\t%s\t%s\n", file.Status, file.Path, file.ID)
+		case file.SHA256 != "":
+			ew.printf("%s\t%s\t%s\tsha256 %s != %s\n", file.Status, file.Path, file.ID, file.SHA256, file.ArchiveSHA256)
+		default:
+			ew.printf("%s\t%s\t%s\tsize %d, archive size %d\n", file.Status, file.Path, file.ID, file.Size, file.ArchiveSize)
+		}
+	}
+	return ew.err
+}
+
+// Verify compares every file with its archive. It stops at the first file which cannot be read,
+// or whose archive cannot be retrieved for reasons other than not being found, or when parentCtx is done.
+func (v *ArchiveVerifier) Verify(parentCtx context.Context) (*VerifyReport, error) {
+	fileCh := make(chan string, 100)
+
+	wg, ctx := errgroup.WithContext(parentCtx)
+
+	wg.Go(func() error {
+		return v.filesFinder.Run(ctx, fileCh)
+	})
+
+	var mu sync.Mutex
+	report := &VerifyReport{Files: []VerifiedFile{}}
+	for i := 0; i < v.workers; i++ {
+		wg.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case fileName, ok := <-fileCh:
+					if !ok {
+						return nil
+					}
+					file, err := v.verifyFile(ctx, fileName)
+					if err != nil {
+						return err
+					}
+					mu.Lock()
+					report.Files = append(report.Files, file)
+					mu.Unlock()
+				}
+			}
+		})
+	}
+
+	if err := wg.Wait(); err != nil {
+		return nil, err
+	}
+	//	an interrupted verification would report the files not verified as neither missing nor mismatched
+	if err := parentCtx.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Path < report.Files[j].Path
+	})
+	logrus.Infof("Verification ended: %d matching, %d missing, %d mismatched", report.Count(VerifyStatusMatching),
+		report.Count(VerifyStatusMissing), report.Count(VerifyStatusMismatched))
+	return report, nil
+}
+
+func (v *ArchiveVerifier) verifyFile(ctx context.Context, fileName string) (VerifiedFile, error) {
+	logrus.Debugf("Verifying file %s", fileName)
+	id, err := v.idMapper.ID(fileName)
+	if err != nil {
+		return VerifiedFile{}, fmt.Errorf("failed building the id of file %s: %w", fileName, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(v.basedir, fileName))
+	if err != nil {
+		return VerifiedFile{}, fmt.Errorf("failed reading file %s: %w", fileName, err)
+	}
+
+	file := VerifiedFile{Path: fileName, ID: id, Size: len(data)}
+	resp, err := v.archiveAPIClient.GetBillFulfilmentArchive(ctx, &bfaa.GetBillFulfilmentArchiveRequest{Id: id})
+	if grpcCode(err) == codes.NotFound {
+		logrus.Warnf("File %s is missing from the archive, id %s", fileName, id)
+		file.Status = VerifyStatusMissing
+		return file, nil
+	}
+	if err != nil {
+		return VerifiedFile{}, fmt.Errorf("failed calling the fulfilment archive api for file %s: %w", fileName, err)
+	}
+
+	archiveData := resp.GetArchive().GetData()
+	file.ArchiveSize = len(archiveData)
+
+	matching := bytes.Equal(data, archiveData)
+	if v.compareSHA256 {
+		sum, archiveSum := sha256.Sum256(data), sha256.Sum256(archiveData)
+		matching = sum == archiveSum
+		if !matching {
+			file.SHA256, file.ArchiveSHA256 = hex.EncodeToString(sum[:]), hex.EncodeToString(archiveSum[:])
+		}
+	}
+
+	file.Status = VerifyStatusMatching
+	if !matching {
+		logrus.Warnf("File %s differs from its archive, id %s", fileName, id)
+		file.Status = VerifyStatusMismatched
+	}
+	return file, nil
+}
@@ -0,0 +1,114 @@
+package ffaac_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func (ti *processorTestInstances) expectArchive(fileName string, data string) {
+	ti.mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.GetBillFulfilmentArchiveRequest{Id: fileName})).
+		Return(&bfaa.GetBillFulfilmentArchiveResponse{Archive: &bfaa.BillFulfilmentArchive{Data: []byte(data)}}, nil).Times(1)
+}
+
+func TestVerify(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	matching, mismatched, missing := "file1.pdf", filepath.Join("fold1", "file2.pdf"), filepath.Join("fold1", "file3.pdf")
+	ti.createTestFiles(t, matching, mismatched, missing)
+
+	ti.expectArchive(matching, matching)
+	ti.expectArchive(mismatched, "other content")
+	ti.mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.GetBillFulfilmentArchiveRequest{Id: missing})).
+		Return(nil, status.Error(codes.NotFound, "not found")).Times(1)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	report, err := ffaac.NewArchiveVerifier(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, nil, false).
+		Verify(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, report.Count(ffaac.VerifyStatusMatching))
+	assert.Equal(t, 1, report.Count(ffaac.VerifyStatusMismatched))
+	assert.Equal(t, 1, report.Count(ffaac.VerifyStatusMissing))
+	assert.Equal(t, 2, report.Discrepancies())
+
+	var out bytes.Buffer
+	require.NoError(t, report.Write(&out))
+	assert.Equal(t, "matching\tfile1.pdf\tfile1.pdf\n"+
+		"mismatched\t"+mismatched+"\t"+mismatched+"\tsize 15, archive size 13\n"+
+		"missing\t"+missing+"\t"+missing+"\n", out.String())
+}
+
+func TestVerifySHA256(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, "file1.pdf", "file2.pdf")
+	ti.expectArchive("file1.pdf", "file1.pdf")
+	ti.expectArchive("file2.pdf", "other content")
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	report, err := ffaac.NewArchiveVerifier(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, nil, true).
+		Verify(context.Background())
+	require.NoError(t, err)
+
+	require.Len(t, report.Files, 2)
+	assert.Equal(t, ffaac.VerifyStatusMatching, report.Files[0].Status)
+	assert.Equal(t, ffaac.VerifyStatusMismatched, report.Files[1].Status)
+	sum := sha256.Sum256([]byte("other content"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), report.Files[1].ArchiveSHA256)
+}
+
+func TestVerifyError(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, "file1.pdf")
+	ti.mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), gomock.Any()).
+		Return(nil, errors.New("unavailable")).Times(1)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	_, err := ffaac.NewArchiveVerifier(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, nil, false).
+		Verify(context.Background())
+	assert.Error(t, err)
+}
+
+func TestVerifyInterrupted(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	var fileNames []string
+	for i := 0; i < 100; i++ {
+		fileNames = append(fileNames, fmt.Sprintf("file%d.pdf", i))
+	}
+	ti.createTestFiles(t, fileNames...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	//	interrupted during the first verifications, which complete
+	ti.mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, in *bfaa.GetBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+			cancel()
+			return &bfaa.GetBillFulfilmentArchiveResponse{Archive: &bfaa.BillFulfilmentArchive{Data: []byte(in.Id)}}, nil
+		}).MinTimes(1).MaxTimes(len(fileNames) - 1)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	_, err := ffaac.NewArchiveVerifier(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, nil, false).Verify(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
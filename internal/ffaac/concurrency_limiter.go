@@ -0,0 +1,130 @@
+package ffaac
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// concurrencyLimiter bounds the number of files processed at once, adapting the bound to the pressure on the archive api:
+// it grows it by one every time as many files as the bound have been saved quickly, and halves it whenever a save
+// is rejected because the archive api is overloaded, or an attempt of it is slower than maxLatency, as normalised by
+// normalisedLatency. The bound stays between min and max.
+type concurrencyLimiter struct {
+	min        int
+	max        int
+	maxLatency time.Duration
+	metrics    *Metrics
+
+	mu     sync.Mutex
+	limit  int
+	active int
+	// healthy counts the quick saves since the last change of the limit
+	healthy int
+	// lastDecrease is when the limit was last decreased, the saves started before then do not decrease it again
+	lastDecrease time.Time
+	// changed is closed, and replaced, whenever a file could start
+	changed chan struct{}
+}
+
+func newConcurrencyLimiter(minWorkers, maxWorkers int, maxLatency time.Duration, metrics *Metrics) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		min:        minWorkers,
+		max:        maxWorkers,
+		maxLatency: maxLatency,
+		metrics:    metrics,
+		limit:      minWorkers,
+		changed:    make(chan struct{}),
+	}
+	metrics.adaptiveConcurrency()
+	metrics.concurrencyChanged(l.limit)
+	return l
+}
+
+// normalisedLatency scales the latency of a request of size bytes down to that of a 1 MiB request,
+// so that the large files, which take longer to upload, are not taken for a sign of pressure.
+// The latency of the smaller requests is left as it is, their upload time being mostly overhead.
+func normalisedLatency(latency time.Duration, size int) time.Duration {
+	if size <= 1<<20 {
+		return latency
+	}
+	return time.Duration(float64(latency) * (1 << 20) / float64(size))
+}
+
+// acquire waits until a file can be processed, or ctx is done. Every successful acquire must be followed by a release.
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (l *concurrencyLimiter) release() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.active--
+	l.notify()
+}
+
+// record adapts the limit to the outcome of a save started at start, whose slowest attempt took latency, normalised.
+func (l *concurrencyLimiter) record(start time.Time, latency time.Duration, overloaded bool, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case overloaded || (l.maxLatency > 0 && latency > l.maxLatency):
+		l.healthy = 0
+		if l.limit == l.min || start.Before(l.lastDecrease) {
+			return
+		}
+		previous := l.limit
+		l.limit /= 2
+		if l.limit < l.min {
+			l.limit = l.min
+		}
+		l.lastDecrease = time.Now()
+		logrus.Warnf("Archive api under pressure, reducing the concurrency from %d to %d", previous, l.limit)
+		l.metrics.concurrencyChanged(l.limit)
+	case err != nil:
+		//	failed for other reasons, which say nothing of the pressure on the archive api
+	default:
+		l.healthy++
+		if l.healthy < l.limit || l.limit == l.max {
+			return
+		}
+		l.healthy = 0
+		l.limit++
+		logrus.Infof("Increasing the concurrency to %d", l.limit)
+		l.metrics.concurrencyChanged(l.limit)
+		l.notify()
+	}
+}
+
+// notify wakes up the workers waiting in acquire. Must be called with mu held.
+func (l *concurrencyLimiter) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
@@ -0,0 +1,91 @@
+package ffaac
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//	the latencies are given to record directly, rather than measured, so that the outcome does not depend on the load
+
+func TestConcurrencyLimiterGrowsWhileQuick(t *testing.T) {
+	l := newConcurrencyLimiter(2, 4, 10*time.Millisecond, nil)
+
+	for _, expectedLimit := range []int{2, 3, 3, 3, 4, 4, 4, 4, 4, 4} {
+		l.record(time.Now(), 10*time.Millisecond, false, nil)
+		assert.Equal(t, expectedLimit, l.limit)
+	}
+}
+
+func TestConcurrencyLimiterBacksOff(t *testing.T) {
+	for name, record := range map[string]func(l *concurrencyLimiter, start time.Time){
+		"overloaded": func(l *concurrencyLimiter, start time.Time) {
+			l.record(start, time.Millisecond, true, errors.New("overloaded"))
+		},
+		"slow": func(l *concurrencyLimiter, start time.Time) {
+			l.record(start, 11*time.Millisecond, false, nil)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			l := newConcurrencyLimiter(3, 16, 10*time.Millisecond, nil)
+			l.limit = 16
+
+			started := time.Now().Add(-time.Second)
+			record(l, time.Now())
+			assert.Equal(t, 8, l.limit)
+			//	started before the decrease, which already accounts for it
+			record(l, started)
+			assert.Equal(t, 8, l.limit)
+
+			record(l, time.Now())
+			assert.Equal(t, 4, l.limit)
+			record(l, time.Now())
+			assert.Equal(t, 3, l.limit)
+			record(l, time.Now())
+			assert.Equal(t, 3, l.limit)
+		})
+	}
+}
+
+func TestConcurrencyLimiterIgnoresOtherErrors(t *testing.T) {
+	l := newConcurrencyLimiter(2, 4, 10*time.Millisecond, nil)
+
+	for i := 0; i < 10; i++ {
+		l.record(time.Now(), time.Millisecond, false, errors.New("invalid"))
+	}
+	assert.Equal(t, 2, l.limit)
+}
+
+func TestConcurrencyLimiterWithoutMaxLatency(t *testing.T) {
+	l := newConcurrencyLimiter(1, 2, 0, nil)
+
+	l.record(time.Now(), time.Hour, false, nil)
+	assert.Equal(t, 2, l.limit)
+}
+
+func TestNormalisedLatency(t *testing.T) {
+	for _, tc := range []struct {
+		latency  time.Duration
+		size     int
+		expected time.Duration
+	}{
+		{latency: 12 * time.Millisecond, size: 0, expected: 12 * time.Millisecond},
+		{latency: 12 * time.Millisecond, size: 1 << 10, expected: 12 * time.Millisecond},
+		{latency: 12 * time.Millisecond, size: 1 << 20, expected: 12 * time.Millisecond},
+		{latency: 12 * time.Millisecond, size: 4 << 20, expected: 3 * time.Millisecond},
+	} {
+		assert.Equal(t, tc.expected, normalisedLatency(tc.latency, tc.size), "%v for %d bytes", tc.latency, tc.size)
+	}
+}
+
+func TestCallAttemptsSlowest(t *testing.T) {
+	attempts := &callAttempts{}
+	assert.Zero(t, attempts.slowestAttempt())
+
+	for _, latency := range []time.Duration{3 * time.Millisecond, 7 * time.Millisecond, 5 * time.Millisecond} {
+		attempts.attemptTook(latency)
+	}
+	assert.Equal(t, 7*time.Millisecond, attempts.slowestAttempt())
+}
@@ -0,0 +1,129 @@
+package ffaac_test
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+// inFlightSave returns a SaveBillFulfilmentArchive taking delay, and failing with failure from the call number failFrom,
+// which records the highest number of saves in flight at once.
+func inFlightSave(delay time.Duration, failFrom int32, failure error) (func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error), *int32) {
+	var calls, inFlight, highest int32
+	return func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+		call := atomic.AddInt32(&calls, 1)
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			h := atomic.LoadInt32(&highest)
+			if n <= h || atomic.CompareAndSwapInt32(&highest, h, n) {
+				break
+			}
+		}
+		time.Sleep(delay)
+		if failFrom > 0 && call >= failFrom {
+			return nil, failure
+		}
+		return &emptypb.Empty{}, nil
+	}, &highest
+}
+
+// processAdaptively uploads files with save, returning the final concurrency.
+func processAdaptively(t *testing.T, files int, save func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error),
+	minWorkers int, maxLatency time.Duration) float64 {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+
+	var fileNames []string
+	for i := 0; i < files; i++ {
+		fileNames = append(fileNames, fmt.Sprintf("file%d.pdf", i))
+	}
+	ti.createTestFiles(t, fileNames...)
+
+	reg := prometheus.NewRegistry()
+	metrics, err := ffaac.NewMetrics(reg)
+	require.NoError(t, err)
+
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, ti.mockFilesFinder,
+		ffaac.WithContinueOnError(), ffaac.WithMetrics(metrics), ffaac.WithAdaptiveConcurrency(minWorkers, maxLatency))
+
+	ti.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			for _, fileName := range fileNames {
+				filesCh <- fileName
+			}
+			close(filesCh)
+			return nil
+		})
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), gomock.Any()).DoAndReturn(save).Times(files)
+
+	_ = processor.ProcessFiles(context.Background())
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "ffaac_upload_concurrency" {
+			return family.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	t.Fatal("ffaac_upload_concurrency not found")
+	return 0
+}
+
+func TestProcessAdaptiveConcurrencyGrows(t *testing.T) {
+	save, highest := inFlightSave(time.Millisecond, 0, nil)
+	concurrency := processAdaptively(t, 200, save, 2, time.Second)
+
+	assert.Equal(t, float64(workers), concurrency)
+	assert.Greater(t, atomic.LoadInt32(highest), int32(2))
+	assert.LessOrEqual(t, atomic.LoadInt32(highest), int32(workers))
+}
+
+func TestProcessAdaptiveConcurrencyBacksOffWhenOverloaded(t *testing.T) {
+	for _, code := range []codes.Code{codes.ResourceExhausted, codes.Unavailable} {
+		t.Run(code.String(), func(t *testing.T) {
+			save, _ := inFlightSave(time.Millisecond, 150, status.Error(code, "overloaded"))
+			assert.Equal(t, float64(2), processAdaptively(t, 200, save, 2, time.Second))
+		})
+	}
+}
+
+func TestProcessAdaptiveConcurrencyIgnoresOtherErrors(t *testing.T) {
+	save, _ := inFlightSave(time.Millisecond, 150, status.Error(codes.InvalidArgument, "invalid"))
+	assert.Equal(t, float64(workers), processAdaptively(t, 200, save, 2, time.Second))
+}
+
+func TestProcessConcurrencyMetricOnlyWhenAdaptive(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+	ti.createTestFiles(t, "file1.pdf")
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), gomock.Any()).Return(&emptypb.Empty{}, nil).Times(1)
+
+	reg := prometheus.NewRegistry()
+	metrics, err := ffaac.NewMetrics(reg)
+	require.NoError(t, err)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithMetrics(metrics))
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		assert.NotEqual(t, "ffaac_upload_concurrency", family.GetName())
+	}
+}
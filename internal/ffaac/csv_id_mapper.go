@@ -0,0 +1,147 @@
+package ffaac
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// NewCSVIDMapper returns an IDMapper looking up the archive IDs in a CSV or TSV table with two columns:
+// the file, either its / separated path relative to the base dir or just its name, and the archive ID.
+// Paths take precedence over names. The table may start with a header row, e.g. path,id.
+// A name only matches a single file: the files with the name of a path entry, or sharing their name with a file already
+// looked up, fail instead of all getting the same ID.
+// Files missing from the table fail in strict mode, otherwise they get the ID given by fallback.
+func NewCSVIDMapper(r io.Reader, tabSeparated bool, fallback IDMapper, strict bool) (IDMapper, error) {
+	br := bufio.NewReader(r)
+	if !tabSeparated {
+		tabSeparated = sniffTabSeparated(br)
+	}
+
+	reader := csv.NewReader(br)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if tabSeparated {
+		reader.Comma = '\t'
+		reader.LazyQuotes = true
+	}
+
+	m := &csvIDMapper{
+		byPath:    make(map[string]string),
+		byName:    make(map[string]string),
+		ambiguous: make(map[string]bool),
+		claimed:   make(map[string]string),
+		fallback:  fallback,
+		strict:    strict,
+	}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed reading id map: %w", err)
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("invalid id map line %d: expected the file and the id, got %d columns", line, len(record))
+		}
+		key, id := filepath.ToSlash(strings.TrimSpace(record[0])), strings.TrimSpace(record[1])
+		if line == 1 && isIDMapHeader(key, id) {
+			continue
+		}
+		if key == "" || id == "" {
+			return nil, fmt.Errorf("invalid id map line %d: empty file or id", line)
+		}
+
+		table := m.byName
+		if strings.Contains(key, "/") {
+			table, key = m.byPath, strings.TrimPrefix(path.Clean(key), "/")
+		}
+		if _, ok := table[key]; ok {
+			return nil, fmt.Errorf("invalid id map line %d: %s is mapped more than once", line, key)
+		}
+		table[key] = id
+	}
+
+	for key := range m.byPath {
+		if _, ok := m.byName[path.Base(key)]; ok {
+			m.ambiguous[path.Base(key)] = true
+		}
+	}
+	return m, nil
+}
+
+type csvIDMapper struct {
+	byPath   map[string]string
+	byName   map[string]string
+	fallback IDMapper
+	strict   bool
+	// ambiguous holds the names of byName which are also the name of a path entry
+	ambiguous map[string]bool
+
+	mu sync.Mutex
+	// claimed holds the file which got the ID of each name looked up, no other file getting it,
+	// so that only the files actually found count
+	claimed map[string]string
+}
+
+func (m *csvIDMapper) ID(fileName string) (string, error) {
+	p := filepath.ToSlash(fileName)
+	if id, ok := m.byPath[p]; ok {
+		return id, nil
+	}
+	name := path.Base(p)
+	if id, ok := m.byName[name]; ok {
+		if err := m.claim(name, p); err != nil {
+			return "", fmt.Errorf("file %s: %w", fileName, err)
+		}
+		return id, nil
+	}
+	if m.strict {
+		return "", fmt.Errorf("file %s not found in the id map", fileName)
+	}
+	return m.fallback.ID(fileName)
+}
+
+// claim gives the id map entry name to the file p, failing if name does not identify a single file.
+func (m *csvIDMapper) claim(name string, p string) error {
+	if m.ambiguous[name] {
+		return fmt.Errorf("the id map entry %s matches more than one file by name", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if claimant, ok := m.claimed[name]; ok && claimant != p {
+		return fmt.Errorf("the id map entry %s matches more than one file by name, %s too", name, claimant)
+	}
+	m.claimed[name] = p
+	return nil
+}
+
+// sniffTabSeparated tells whether the first line of the table contains tabs but no commas.
+func sniffTabSeparated(br *bufio.Reader) bool {
+	firstLine, _ := br.Peek(br.Size())
+	if i := strings.IndexByte(string(firstLine), '\n'); i >= 0 {
+		firstLine = firstLine[:i]
+	}
+	return strings.Contains(string(firstLine), "\t") && !strings.Contains(string(firstLine), ",")
+}
+
+func isIDMapHeader(key string, id string) bool {
+	switch strings.ToLower(key) {
+	case "path", "file", "filename", "file_name":
+	default:
+		return false
+	}
+	switch strings.ToLower(id) {
+	case "id", "archive_id":
+		return true
+	}
+	return false
+}
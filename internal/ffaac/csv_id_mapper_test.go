@@ -0,0 +1,165 @@
+package ffaac_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestCSVIDMapper(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		table        string
+		tabSeparated bool
+	}{
+		{name: "csv with header", table: "path,id\nbatch-0001.pdf,bill-1\n2023/01/batch-0002.pdf,bill-2\n\"batch,3.pdf\",bill-3\n"},
+		{name: "csv without header", table: "batch-0001.pdf,bill-1\n2023/01/batch-0002.pdf, bill-2\n\"batch,3.pdf\",bill-3\n"},
+		{name: "tsv sniffed", table: "file\tid\nbatch-0001.pdf\tbill-1\n2023/01/batch-0002.pdf\tbill-2\nbatch,3.pdf\tbill-3\n"},
+		{name: "tsv", table: "batch-0001.pdf\tbill-1\n2023/01/batch-0002.pdf\tbill-2\nbatch,3.pdf\tbill-3\n", tabSeparated: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idMapper, err := ffaac.NewCSVIDMapper(strings.NewReader(tc.table), tc.tabSeparated, ffaac.NewPathIDMapper(), false)
+			require.NoError(t, err)
+
+			for _, lookup := range []struct {
+				fileName   string
+				expectedID string
+			}{
+				{fileName: "batch-0001.pdf", expectedID: "bill-1"},
+				{fileName: "batch-0001.pdf", expectedID: "bill-1"},
+				{fileName: filepath.Join("2023", "01", "batch-0002.pdf"), expectedID: "bill-2"},
+				{fileName: filepath.Join("2023", "02", "batch-0002.pdf"), expectedID: filepath.Join("2023", "02", "batch-0002.pdf")},
+				{fileName: "batch,3.pdf", expectedID: "bill-3"},
+				{fileName: "unmapped.pdf", expectedID: "unmapped.pdf"},
+			} {
+				id, err := idMapper.ID(lookup.fileName)
+				require.NoError(t, err)
+				assert.Equal(t, lookup.expectedID, id, lookup.fileName)
+			}
+
+			//	another file with the name of one already looked up
+			_, err = idMapper.ID(filepath.Join("2023", "02", "batch-0001.pdf"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCSVIDMapperAmbiguousNames(t *testing.T) {
+	table := "batch-0001.pdf,bill-1\nbatch-0002.pdf,bill-2\n2023/01/batch-0002.pdf,bill-22\n"
+	idMapper, err := ffaac.NewCSVIDMapper(strings.NewReader(table), false, ffaac.NewPathIDMapper(), false)
+	require.NoError(t, err)
+
+	//	the first file found with the name gets its ID, the others fail
+	id, err := idMapper.ID("batch-0001.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "bill-1", id)
+	_, err = idMapper.ID(filepath.Join("2023", "02", "batch-0001.pdf"))
+	assert.Error(t, err)
+	id, err = idMapper.ID("batch-0001.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "bill-1", id)
+
+	//	also the name of a path entry
+	id, err = idMapper.ID(filepath.Join("2023", "01", "batch-0002.pdf"))
+	require.NoError(t, err)
+	assert.Equal(t, "bill-22", id)
+	_, err = idMapper.ID(filepath.Join("2023", "02", "batch-0002.pdf"))
+	assert.Error(t, err)
+}
+
+func TestCSVIDMapperStrict(t *testing.T) {
+	idMapper, err := ffaac.NewCSVIDMapper(strings.NewReader("batch-0001.pdf,bill-1\n"), false, ffaac.NewPathIDMapper(), true)
+	require.NoError(t, err)
+
+	id, err := idMapper.ID("batch-0001.pdf")
+	require.NoError(t, err)
+	assert.Equal(t, "bill-1", id)
+
+	_, err = idMapper.ID("unmapped.pdf")
+	assert.Error(t, err)
+}
+
+func TestCSVIDMapperInvalidTables(t *testing.T) {
+	for name, table := range map[string]string{
+		"one column": "batch-0001.pdf\n",
+		"empty id":   "batch-0001.pdf,\n",
+		"duplicate":  "batch-0001.pdf,bill-1\nbatch-0001.pdf,bill-2\n",
+	} {
+		_, err := ffaac.NewCSVIDMapper(strings.NewReader(table), false, ffaac.NewPathIDMapper(), false)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestProcessWithStrictIDMap(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, "batch-0001.pdf", "batch-0002.pdf")
+
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.SaveBillFulfilmentArchiveRequest{
+		Id:      "bill-1",
+		Archive: &bfaa.BillFulfilmentArchive{Data: []byte("batch-0001.pdf")},
+	})).Return(nil, nil).Times(1)
+
+	idMapper, err := ffaac.NewCSVIDMapper(strings.NewReader("batch-0001.pdf,bill-1\n"), false, ffaac.NewPathIDMapper(), true)
+	require.NoError(t, err)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithIDMapper(idMapper), ffaac.WithContinueOnError())
+	err = processor.ProcessFiles(context.Background())
+	assert.True(t, errors.Is(err, ffaac.ErrFilesFailed))
+
+	report := processor.FailureReport()
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, "batch-0002.pdf", report.Failures[0].Path)
+	assert.Equal(t, ffaac.FailureReasonID, report.Failures[0].Reason)
+}
+
+func TestProcessWithAmbiguousIDMapName(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, filepath.Join("2023", "01", "batch-0001.pdf"), filepath.Join("2023", "02", "batch-0001.pdf"))
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), gomock.Any()).Return(nil, nil).Times(1)
+
+	idMapper, err := ffaac.NewCSVIDMapper(strings.NewReader("batch-0001.pdf,bill-1\n"), false, ffaac.NewPathIDMapper(), false)
+	require.NoError(t, err)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, 1, filesFinder, ffaac.WithIDMapper(idMapper), ffaac.WithContinueOnError())
+	err = processor.ProcessFiles(context.Background())
+	assert.True(t, errors.Is(err, ffaac.ErrFilesFailed))
+
+	report := processor.FailureReport()
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, ffaac.FailureReasonID, report.Failures[0].Reason)
+}
+
+func TestProcessWithIDMapNameDuplicatedInExcludedDir(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, filepath.Join("2023", "01", "batch-0001.pdf"), filepath.Join("drafts", "batch-0001.pdf"))
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.SaveBillFulfilmentArchiveRequest{
+		Id:      "bill-1",
+		Archive: &bfaa.BillFulfilmentArchive{Data: []byte(filepath.Join("2023", "01", "batch-0001.pdf"))},
+	})).Return(nil, nil).Times(1)
+
+	idMapper, err := ffaac.NewCSVIDMapper(strings.NewReader("batch-0001.pdf,bill-1\n"), false, ffaac.NewPathIDMapper(), true)
+	require.NoError(t, err)
+	filter, err := ffaac.NewFileFilter(nil, []string{"drafts"})
+	require.NoError(t, err)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"}, ffaac.WithFileFilter(filter))
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithIDMapper(idMapper))
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
@@ -0,0 +1,95 @@
+package ffaac
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrDrained is returned by the FilesProcessor when Drain stopped it before all the files were processed.
+var ErrDrained = errors.New("processing stopped before the end")
+
+// drainer is how a running FilesProcessor is told to drain.
+type drainer struct {
+	once     sync.Once
+	draining chan struct{}
+	// timeout is written before draining is closed, and only read after
+	timeout time.Duration
+
+	abortOnce sync.Once
+	// aborting is closed once the uploads still running when draining timed out are cancelled
+	aborting chan struct{}
+}
+
+func newDrainer() *drainer {
+	return &drainer{draining: make(chan struct{}), aborting: make(chan struct{})}
+}
+
+func (d *drainer) drain(timeout time.Duration) {
+	d.once.Do(func() {
+		d.timeout = timeout
+		close(d.draining)
+	})
+}
+
+func (d *drainer) drained() bool {
+	select {
+	case <-d.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// abort records that the uploads are being cancelled because draining timed out.
+func (d *drainer) abort() {
+	d.abortOnce.Do(func() {
+		close(d.aborting)
+	})
+}
+
+func (d *drainer) aborted() bool {
+	select {
+	case <-d.aborting:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain makes a running ProcessFiles stop looking for files, and stop starting new ones, while the files being uploaded
+// are given up to timeout to complete, 0 meaning as long as they take. Those still uploading then are cancelled.
+// ProcessFiles then returns ErrDrained, without waiting for the FilesFinder, which may be blocked reading its input,
+// and Unprocessed lists the files found but not uploaded, the cancelled ones included.
+// Drain can be called from any goroutine, any number of times, only the first call counting.
+func (p *FilesProcessor) Drain(timeout time.Duration) {
+	p.drainer.drain(timeout)
+}
+
+// Unprocessed returns the files which were found but not uploaded because the processing was drained,
+// whether they were still queued or their uploads were cancelled when draining timed out.
+func (p *FilesProcessor) Unprocessed() []string {
+	return p.unprocessed.list()
+}
+
+type fileList struct {
+	mu    sync.Mutex
+	files []string
+}
+
+func (l *fileList) add(fileName string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.files = append(l.files, fileName)
+}
+
+func (l *fileList) list() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	files := make([]string, len(l.files))
+	copy(files, l.files)
+	sort.Strings(files)
+	return files
+}
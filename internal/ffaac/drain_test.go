@@ -0,0 +1,198 @@
+package ffaac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+// drainTest sends many files to a processor whose saves block until release is closed, or their context is done.
+type drainTest struct {
+	processorTestInstances
+	sent    int32
+	saved   int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func initDrainTest(t *testing.T, opts ...ffaac.ProcessorOption) *drainTest {
+	dt := &drainTest{
+		processorTestInstances: initProcessorWithMockFinder(t),
+		started:                make(chan struct{}, 1000),
+		release:                make(chan struct{}),
+	}
+
+	var fileNames []string
+	for i := 0; i < 500; i++ {
+		fileNames = append(fileNames, fmt.Sprintf("file%d.pdf", i))
+	}
+	dt.createTestFiles(t, fileNames...)
+	dt.processor = ffaac.NewFileProcessor(dt.mockArchiveAPIClient, dt.basedir, workers, dt.mockFilesFinder, opts...)
+
+	dt.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			defer close(filesCh)
+			for _, fileName := range fileNames {
+				select {
+				case <-ctx.Done():
+					return nil
+				case filesCh <- fileName:
+					atomic.AddInt32(&dt.sent, 1)
+				}
+			}
+			return nil
+		})
+	dt.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+			dt.started <- struct{}{}
+			select {
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			case <-dt.release:
+				atomic.AddInt32(&dt.saved, 1)
+				return &emptypb.Empty{}, nil
+			}
+		}).AnyTimes()
+	return dt
+}
+
+// process runs ProcessFiles with ctx, returning its result once done.
+func (dt *drainTest) process(ctx context.Context) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- dt.processor.ProcessFiles(ctx)
+	}()
+	<-dt.started
+	return errCh
+}
+
+func TestProcessDrainLetsUploadsComplete(t *testing.T) {
+	dt := initDrainTest(t, ffaac.WithContinueOnError())
+	defer dt.finish()
+
+	errCh := dt.process(context.Background())
+	dt.processor.Drain(0)
+	time.Sleep(20 * time.Millisecond)
+	close(dt.release)
+
+	err := <-errCh
+	assert.True(t, errors.Is(err, ffaac.ErrDrained))
+
+	unprocessed := dt.processor.Unprocessed()
+	assert.Greater(t, atomic.LoadInt32(&dt.saved), int32(0))
+	assert.NotEmpty(t, unprocessed)
+	assert.Less(t, int(atomic.LoadInt32(&dt.sent)), 500)
+	assert.Equal(t, int(atomic.LoadInt32(&dt.sent)), int(atomic.LoadInt32(&dt.saved))+len(unprocessed))
+
+	report := dt.processor.FailureReport()
+	require.Len(t, report.Failures, len(unprocessed))
+	for i, failure := range report.Failures {
+		assert.Equal(t, unprocessed[i], failure.Path)
+		assert.Equal(t, ffaac.FailureReasonUnprocessed, failure.Reason)
+	}
+}
+
+func TestProcessDrainCancelsUploadsAfterTimeout(t *testing.T) {
+	for name, opts := range map[string][]ffaac.ProcessorOption{
+		"stop on error":     nil,
+		"continue on error": {ffaac.WithContinueOnError()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dt := initDrainTest(t, opts...)
+			defer dt.finish()
+
+			errCh := dt.process(context.Background())
+			start := time.Now()
+			dt.processor.Drain(50 * time.Millisecond)
+
+			err := <-errCh
+			assert.True(t, errors.Is(err, ffaac.ErrDrained))
+			assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+			assert.Less(t, time.Since(start), time.Second)
+
+			//	the cancelled files too, none having been saved
+			assert.Zero(t, atomic.LoadInt32(&dt.saved))
+			assert.Len(t, dt.processor.Unprocessed(), int(atomic.LoadInt32(&dt.sent)))
+			report := dt.processor.FailureReport()
+			assert.Len(t, report.Failures, int(atomic.LoadInt32(&dt.sent)))
+			for _, failure := range report.Failures {
+				assert.Equal(t, ffaac.FailureReasonUnprocessed, failure.Reason)
+			}
+		})
+	}
+}
+
+func TestProcessDrainDoesNotWaitForBlockedFinder(t *testing.T) {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+	ti.createTestFiles(t, "file1.pdf", "file2.pdf", "file3.pdf")
+
+	//	the manifest is never closed, as stdin when nothing more is written to it
+	manifest, manifestWriter := io.Pipe()
+	defer manifestWriter.Close()
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+			started <- struct{}{}
+			<-release
+			return &emptypb.Empty{}, nil
+		}).Times(1)
+
+	filesFinder := ffaac.NewManifestFilesFinder(ti.basedir, manifest, false)
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, 1, filesFinder)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- processor.ProcessFiles(context.Background())
+	}()
+
+	_, err := fmt.Fprintf(manifestWriter, "%s\n%s\n%s\n",
+		filepath.Join(ti.basedir, "file1.pdf"), filepath.Join(ti.basedir, "file2.pdf"), filepath.Join(ti.basedir, "file3.pdf"))
+	require.NoError(t, err)
+	<-started
+	processor.Drain(0)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-errCh:
+		assert.True(t, errors.Is(err, ffaac.ErrDrained))
+	case <-time.After(time.Second):
+		t.Fatal("ProcessFiles waited for the finder to reach the end of its input")
+	}
+	assert.Equal(t, []string{"file2.pdf", "file3.pdf"}, processor.Unprocessed())
+}
+
+func TestProcessAbortWhileDraining(t *testing.T) {
+	dt := initDrainTest(t)
+	defer dt.finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := dt.process(ctx)
+	dt.processor.Drain(0)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.Equal(t, codes.Canceled, status.Code(errors.Unwrap(err)))
+	case <-time.After(time.Second):
+		t.Fatal("ProcessFiles did not return once cancelled")
+	}
+	assert.Zero(t, atomic.LoadInt32(&dt.saved))
+}
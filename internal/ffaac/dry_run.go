@@ -0,0 +1,203 @@
+package ffaac
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// largestFilesInPlan is the number of largest files listed in the DryRunPlan.
+const largestFilesInPlan = 10
+
+type filePathKey struct{}
+
+func contextWithFilePath(ctx context.Context, fileName string) context.Context {
+	return context.WithValue(ctx, filePathKey{}, fileName)
+}
+
+// FilePathFromContext returns the base relative path of the file being saved, for the calls made by the FilesProcessor.
+func FilePathFromContext(ctx context.Context) (string, bool) {
+	fileName, ok := ctx.Value(filePathKey{}).(string)
+	return fileName, ok
+}
+
+// DryRunArchiveAPIClient is a BillFulfilmentArchiveAPIClient which saves nothing, only recording the files
+// it is asked to save so that they can be reported. It holds no archive, so the get calls always return NotFound.
+type DryRunArchiveAPIClient struct {
+	mu    sync.Mutex
+	files []PlannedFile
+}
+
+// PlannedFile is a file which would be saved by an upload.
+type PlannedFile struct {
+	Path string
+	ID   string
+	Size int
+}
+
+func NewDryRunArchiveAPIClient() *DryRunArchiveAPIClient {
+	return &DryRunArchiveAPIClient{}
+}
+
+func (c *DryRunArchiveAPIClient) SaveBillFulfilmentArchive(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	fileName, ok := FilePathFromContext(ctx)
+	if !ok {
+		fileName = in.GetId()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files = append(c.files, PlannedFile{Path: fileName, ID: in.GetId(), Size: len(in.GetArchive().GetData())})
+	return &emptypb.Empty{}, nil
+}
+
+func (c *DryRunArchiveAPIClient) GetBillFulfilmentArchive(ctx context.Context, in *bfaa.GetBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+	return nil, status.Errorf(codes.NotFound, "dry run: archive %s not found", in.GetId())
+}
+
+func (c *DryRunArchiveAPIClient) GetBillFulfilmentArchiveByAccountNumber(ctx context.Context, in *bfaa.GetBillFulfilmentArchiveByAccountNumberRequest, opts ...grpc.CallOption) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+	return nil, status.Errorf(codes.NotFound, "dry run: archive for account number %s not found", in.GetAccountNumber())
+}
+
+func (c *DryRunArchiveAPIClient) GetBillFulfilmentArchiveByRequestID(ctx context.Context, in *bfaa.GetBillFulfilmentArchiveByRequestIDRequest, opts ...grpc.CallOption) (*bfaa.GetBillFulfilmentArchiveResponse, error) {
+	return nil, status.Errorf(codes.NotFound, "dry run: archive for request id %s not found", in.GetRequestId())
+}
+
+func (c *DryRunArchiveAPIClient) DeleteBillFulfilmentArchive(ctx context.Context, in *bfaa.DeleteBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "dry run: delete not supported")
+}
+
+func (c *DryRunArchiveAPIClient) DeleteBillFulfilmentArchiveByAccountNumber(ctx context.Context, in *bfaa.DeleteBillFulfilmentArchiveByAccountNumberRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "dry run: delete not supported")
+}
+
+func (c *DryRunArchiveAPIClient) DeleteBillFulfilmentArchiveByRequestID(ctx context.Context, in *bfaa.DeleteBillFulfilmentArchiveByRequestIDRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "dry run: delete not supported")
+}
+
+// Plan summarises the files recorded so far.
+func (c *DryRunArchiveAPIClient) Plan() *DryRunPlan {
+	c.mu.Lock()
+	files := make([]PlannedFile, len(c.files))
+	copy(files, c.files)
+	c.mu.Unlock()
+
+	plan := &DryRunPlan{
+		Files:       files,
+		ByExtension: make(map[string]*PlanBreakdown),
+		ByDir:       make(map[string]*PlanBreakdown),
+	}
+	sort.Slice(plan.Files, func(i, j int) bool {
+		return plan.Files[i].Path < plan.Files[j].Path
+	})
+
+	for _, file := range plan.Files {
+		plan.TotalBytes += int64(file.Size)
+
+		p := filepath.ToSlash(file.Path)
+		ext := strings.ToLower(path.Ext(p))
+		if ext == "" {
+			ext = "(none)"
+		}
+		plan.ByExtension[ext] = plan.ByExtension[ext].add(file.Size)
+		plan.ByDir[path.Dir(p)] = plan.ByDir[path.Dir(p)].add(file.Size)
+	}
+
+	plan.Largest = make([]PlannedFile, len(plan.Files))
+	copy(plan.Largest, plan.Files)
+	sort.SliceStable(plan.Largest, func(i, j int) bool {
+		return plan.Largest[i].Size > plan.Largest[j].Size
+	})
+	if len(plan.Largest) > largestFilesInPlan {
+		plan.Largest = plan.Largest[:largestFilesInPlan]
+	}
+	return plan
+}
+
+// DryRunPlan describes what an upload would do.
+type DryRunPlan struct {
+	Files       []PlannedFile
+	TotalBytes  int64
+	Largest     []PlannedFile
+	ByExtension map[string]*PlanBreakdown
+	ByDir       map[string]*PlanBreakdown
+}
+
+// PlanBreakdown counts the files, and their bytes, of a group of the DryRunPlan.
+type PlanBreakdown struct {
+	Files int
+	Bytes int64
+}
+
+func (b *PlanBreakdown) add(size int) *PlanBreakdown {
+	if b == nil {
+		b = &PlanBreakdown{}
+	}
+	b.Files++
+	b.Bytes += int64(size)
+	return b
+}
+
+// Write prints the plan in a human readable form, ending with the path and the ID of every file separated by a tab.
+func (p *DryRunPlan) Write(w io.Writer) error {
+	ew := &errWriter{w: w}
+
+	ew.printf("Files: %d\n", len(p.Files))
+	ew.printf("Total bytes: %d\n", p.TotalBytes)
+
+	ew.printf("\nLargest files:\n")
+	for _, file := range p.Largest {
+		ew.printf("  %12d  %s\n", file.Size, file.Path)
+	}
+
+	ew.printf("\nBy extension:\n")
+	writeBreakdown(ew, p.ByExtension)
+
+	ew.printf("\nBy directory:\n")
+	writeBreakdown(ew, p.ByDir)
+
+	ew.printf("\nIDs:\n")
+	for _, file := range p.Files {
+		ew.printf("%s\t%s\n", file.Path, file.ID)
+	}
+	return ew.err
+}
+
+func writeBreakdown(ew *errWriter, breakdown map[string]*PlanBreakdown) {
+	keys := make([]string, 0, len(breakdown))
+	for key := range breakdown {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		ew.printf("  %8d files  %12d bytes  %s\n", breakdown[key].Files, breakdown[key].Bytes, key)
+	}
+}
+
+// errWriter remembers the first write error, so that it can be checked once at the end.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	if _, err := fmt.Fprintf(ew.w, format, args...); err != nil {
+		ew.err = fmt.Errorf("failed writing the dry run plan: %w", err)
+	}
+}
+
+var _ bfaa.BillFulfilmentArchiveAPIClient = (*DryRunArchiveAPIClient)(nil)
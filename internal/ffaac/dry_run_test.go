@@ -0,0 +1,59 @@
+package ffaac_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestProcessDryRun(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf", "csv")
+	defer ti.finish()
+
+	files := []string{
+		"file1.pdf",
+		filepath.Join("fold1", "file2.pdf"),
+		filepath.Join("fold1", "longer-file3.csv"),
+		filepath.Join("fold1", "fold2", "file4.pdf"),
+	}
+	ti.createTestFiles(t, files...)
+
+	idMapper, err := ffaac.NewTemplateIDMapper("{stem}", "", "bills/", "")
+	require.NoError(t, err)
+
+	dryRunClient := ffaac.NewDryRunArchiveAPIClient()
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf", "csv"})
+	processor := ffaac.NewFileProcessor(dryRunClient, ti.basedir, workers, filesFinder, ffaac.WithIDMapper(idMapper))
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+
+	plan := dryRunClient.Plan()
+	require.Len(t, plan.Files, 4)
+	assert.Equal(t, ffaac.PlannedFile{Path: "file1.pdf", ID: "bills/file1", Size: len("file1.pdf")}, plan.Files[0])
+
+	var totalBytes int64
+	for _, fileName := range files {
+		totalBytes += int64(len(fileName))
+	}
+	assert.Equal(t, totalBytes, plan.TotalBytes)
+
+	assert.Equal(t, filepath.Join("fold1", "longer-file3.csv"), plan.Largest[0].Path)
+	assert.Equal(t, "file1.pdf", plan.Largest[3].Path)
+
+	assert.Equal(t, 3, plan.ByExtension[".pdf"].Files)
+	assert.Equal(t, 1, plan.ByExtension[".csv"].Files)
+	assert.Equal(t, int64(len(files[1])+len(files[2])), plan.ByDir["fold1"].Bytes)
+	assert.Equal(t, 1, plan.ByDir["."].Files)
+	assert.Equal(t, 1, plan.ByDir["fold1/fold2"].Files)
+
+	var out bytes.Buffer
+	require.NoError(t, plan.Write(&out))
+	assert.Contains(t, out.String(), "Files: 4\n")
+	assert.True(t, strings.HasSuffix(out.String(), filepath.Join("fold1", "longer-file3.csv")+"\tbills/longer-file3\n"))
+}
@@ -0,0 +1,205 @@
+package ffaac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrFilesFailed is returned by the FilesProcessor, in continue on error mode, when some files could not be saved.
+var ErrFilesFailed = errors.New("some files failed")
+
+// Failure reasons, telling at which stage a file failed.
+const (
+	FailureReasonRead = "read"
+	FailureReasonID   = "id"
+	FailureReasonAPI  = "api"
+	// FailureReasonTimeout is an api call which did not complete in time, because of the call or of the run timeout.
+	FailureReasonTimeout = "timeout"
+	// FailureReasonUnprocessed is a file found but never uploaded, because the processing was drained.
+	FailureReasonUnprocessed = "unprocessed"
+)
+
+// FileError is the error returned when a single file cannot be saved.
+type FileError struct {
+	Path     string
+	Reason   string
+	Attempts int
+	Err      error
+	msg      string
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileFailure describes a file which could not be saved, in the failure report.
+type FileFailure struct {
+	Path     string `json:"path"`
+	Reason   string `json:"reason"`
+	Code     string `json:"code,omitempty"`
+	Message  string `json:"message"`
+	Attempts int    `json:"attempts"`
+}
+
+// FailureReport lists all the files which could not be saved during a run.
+type FailureReport struct {
+	Basedir  string        `json:"basedir"`
+	Failures []FileFailure `json:"failures"`
+}
+
+// WriteFile writes the report as JSON to the file at path.
+func (r *FailureReport) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding the failure report: %w", err)
+	}
+	return writeFileAtomically(path, append(data, '\n'))
+}
+
+// ReadFailureReport reads a report written by FailureReport.WriteFile.
+func ReadFailureReport(path string) (*FailureReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading failure report %s: %w", path, err)
+	}
+
+	var report FailureReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed decoding failure report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+// Paths returns the base relative paths of all the failed files.
+func (r *FailureReport) Paths() []string {
+	paths := make([]string, 0, len(r.Failures))
+	for _, failure := range r.Failures {
+		paths = append(paths, failure.Path)
+	}
+	return paths
+}
+
+type failureCollector struct {
+	mu       sync.Mutex
+	failures []FileFailure
+}
+
+func (c *failureCollector) add(fileErr *FileError) {
+	failure := FileFailure{
+		Path:     fileErr.Path,
+		Reason:   fileErr.Reason,
+		Message:  fileErr.Err.Error(),
+		Attempts: fileErr.Attempts,
+	}
+	if fileErr.Reason == FailureReasonAPI || fileErr.Reason == FailureReasonTimeout {
+		failure.Code = grpcCode(fileErr.Err).String()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, failure)
+}
+
+func (c *failureCollector) list() []FileFailure {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	failures := make([]FileFailure, len(c.failures))
+	copy(failures, c.failures)
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Path < failures[j].Path
+	})
+	return failures
+}
+
+type attemptsCounterKey struct{}
+
+// callAttempts counts the attempts made for a call of the FilesProcessor.
+type callAttempts struct {
+	count int32
+	// overloaded counts the attempts which failed because the archive api was under pressure
+	overloaded int32
+	// slowest is the longest latency of the attempts, normalised by the request size, in nanoseconds
+	slowest int64
+}
+
+func (a *callAttempts) attempts() int {
+	return int(atomic.LoadInt32(&a.count))
+}
+
+func (a *callAttempts) overloadedAttempts() int {
+	return int(atomic.LoadInt32(&a.overloaded))
+}
+
+// slowestAttempt returns the longest latency of the attempts, normalised by the request size with normalisedLatency.
+func (a *callAttempts) slowestAttempt() time.Duration {
+	return time.Duration(atomic.LoadInt64(&a.slowest))
+}
+
+func (a *callAttempts) attemptTook(latency time.Duration) {
+	for {
+		slowest := atomic.LoadInt64(&a.slowest)
+		if int64(latency) <= slowest || atomic.CompareAndSwapInt64(&a.slowest, slowest, int64(latency)) {
+			return
+		}
+	}
+}
+
+func withAttemptsCounter(ctx context.Context) (context.Context, *callAttempts) {
+	counter := &callAttempts{}
+	return context.WithValue(ctx, attemptsCounterKey{}, counter), counter
+}
+
+// AttemptsCounterInterceptor counts the attempts made for the calls of the FilesProcessor, so that they can be reported,
+// and the ones failed because the archive api was under pressure, or slow, to adapt the concurrency.
+// It must run after any retrying interceptor, to see every single attempt without the backoffs between them.
+func AttemptsCounterInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	counter, ok := ctx.Value(attemptsCounterKey{}).(*callAttempts)
+	if !ok {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+
+	atomic.AddInt32(&counter.count, 1)
+	start := time.Now()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	size := 0
+	if msg, ok := req.(proto.Message); ok {
+		size = proto.Size(msg)
+	}
+	counter.attemptTook(normalisedLatency(time.Since(start), size))
+	if isOverloaded(err) {
+		atomic.AddInt32(&counter.overloaded, 1)
+	}
+	return err
+}
+
+// isOverloaded tells whether err is the archive api rejecting a call because it is under pressure.
+func isOverloaded(err error) bool {
+	code := grpcCode(err)
+	return code == codes.ResourceExhausted || code == codes.Unavailable
+}
+
+// grpcCode returns the gRPC status code of err, looking through any wrapping.
+func grpcCode(err error) codes.Code {
+	var se interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &se) {
+		return se.GRPCStatus().Code()
+	}
+	return status.Code(err)
+}
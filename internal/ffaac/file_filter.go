@@ -0,0 +1,120 @@
+package ffaac
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// RegexPatternPrefix marks an include or exclude pattern as a regular expression rather than a glob.
+const RegexPatternPrefix = "re:"
+
+// FileFilter selects the files to process by matching their base relative paths, always / separated,
+// against include and exclude patterns.
+// Patterns are doublestar globs (e.g. tmp/**, **/*_draft.pdf) or, when prefixed by re:, regular expressions.
+type FileFilter struct {
+	includes []pathMatcher
+	excludes []pathMatcher
+}
+
+type pathMatcher interface {
+	match(path string) bool
+	matchDir(dir string) bool
+}
+
+// NewFileFilter returns a filter which accepts the files matching at least one of the includes, if any,
+// and none of the excludes.
+func NewFileFilter(includes []string, excludes []string) (*FileFilter, error) {
+	f := &FileFilter{}
+	for _, pattern := range includes {
+		m, err := newPathMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.includes = append(f.includes, m)
+	}
+	for _, pattern := range excludes {
+		m, err := newPathMatcher(pattern)
+		if err != nil {
+			return nil, err
+		}
+		f.excludes = append(f.excludes, m)
+	}
+	return f, nil
+}
+
+func newPathMatcher(pattern string) (pathMatcher, error) {
+	if strings.HasPrefix(pattern, RegexPatternPrefix) {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, RegexPatternPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex pattern %q: %w", pattern, err)
+		}
+		return regexMatcher{re: re}, nil
+	}
+
+	if !doublestar.ValidatePattern(pattern) {
+		return nil, fmt.Errorf("invalid glob pattern %q", pattern)
+	}
+	return globMatcher{pattern: pattern}, nil
+}
+
+// Includes tells whether the file at the base relative path should be processed.
+func (f *FileFilter) Includes(path string) bool {
+	path = filepath.ToSlash(path)
+	for _, m := range f.excludes {
+		if m.match(path) {
+			return false
+		}
+	}
+	if len(f.includes) == 0 {
+		return true
+	}
+	for _, m := range f.includes {
+		if m.match(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludesDir tells whether the whole dir at the base relative path can be skipped, without listing its content.
+func (f *FileFilter) ExcludesDir(dir string) bool {
+	dir = filepath.ToSlash(dir)
+	for _, m := range f.excludes {
+		if m.matchDir(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+type globMatcher struct {
+	pattern string
+}
+
+func (m globMatcher) match(path string) bool {
+	// the pattern has been validated, so Match cannot fail
+	ok, _ := doublestar.Match(m.pattern, path)
+	return ok
+}
+
+// matchDir matches the dir itself, which also covers patterns like dir/** matching all of its content.
+func (m globMatcher) matchDir(dir string) bool {
+	return m.match(dir)
+}
+
+type regexMatcher struct {
+	re *regexp.Regexp
+}
+
+func (m regexMatcher) match(path string) bool {
+	return m.re.MatchString(path)
+}
+
+// matchDir matches the dir followed by a /, so that a regex like (^|/)tmp/ excludes the tmp dirs.
+func (m regexMatcher) matchDir(dir string) bool {
+	return m.re.MatchString(dir + "/")
+}
@@ -0,0 +1,96 @@
+package ffaac_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestFileFilter(t *testing.T) {
+	filter, err := ffaac.NewFileFilter(
+		[]string{"bills/**", `re:^statements/\d{4}/`},
+		[]string{"**/tmp/**", "**/*_draft.pdf", `re:(^|/)\.`},
+	)
+	require.NoError(t, err)
+
+	for path, included := range map[string]bool{
+		"bills/one.pdf":                 true,
+		"bills/2023/01/one.pdf":         true,
+		"bills/2023/01/one_draft.pdf":   false,
+		"bills/tmp/one.pdf":             false,
+		"bills/2023/tmp/one.pdf":        false,
+		"bills/.hidden.pdf":             false,
+		"statements/2023/one.pdf":       true,
+		"statements/old/one.pdf":        false,
+		"other/one.pdf":                 false,
+		filepath.Join("bills", "x.pdf"): true,
+	} {
+		assert.Equal(t, included, filter.Includes(path), path)
+	}
+
+	for dir, excluded := range map[string]bool{
+		"bills":          false,
+		"tmp":            true,
+		"bills/2023/tmp": true,
+		"bills/.cache":   true,
+		"bills/tmpfiles": false,
+	} {
+		assert.Equal(t, excluded, filter.ExcludesDir(dir), dir)
+	}
+}
+
+func TestFileFilterInvalidPatterns(t *testing.T) {
+	_, err := ffaac.NewFileFilter([]string{"bills/[a-"}, nil)
+	assert.Error(t, err)
+
+	_, err = ffaac.NewFileFilter(nil, []string{"re:("})
+	assert.Error(t, err)
+}
+
+func TestProcessWithIncludeExcludeRules(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	includedFiles := []string{"one.pdf", filepath.Join("fold1", "two.pdf")}
+	excludedFiles := []string{
+		"notapdf",
+		"UPPER.PDF",
+		"one_draft.pdf",
+		filepath.Join("tmp", "three.pdf"),
+		filepath.Join("fold1", "tmp", "four.pdf"),
+		filepath.Join("fold1", "two_draft.pdf"),
+	}
+	ti.createTestFiles(t, append(includedFiles, excludedFiles...)...)
+
+	for _, fileName := range includedFiles {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+
+	filter, err := ffaac.NewFileFilter(nil, []string{"**/tmp", "**/*_draft.pdf"})
+	require.NoError(t, err)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"}, ffaac.WithFileFilter(filter))
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder)
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
+
+func TestProcessWithEmptyExtension(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", "two.csv", "noextension", filepath.Join("fold1", "three.txt")}
+	ti.createTestFiles(t, fileNames...)
+	for _, fileName := range fileNames {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{""})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder)
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
@@ -8,52 +8,104 @@ import (
 	"strings"
 )
 
+// FilesFinder is the source of the files to process: it sends their paths, relative to the base dir, on filesCh
+// and closes it when done.
 type FilesFinder interface {
 	Run(ctx context.Context, filesCh chan<- string) error
 }
 
-func NewFilesFinder(basedir string, recursive bool, fileExtensions []string,
+// FinderOption configures optional behaviours of the FilesFinder returned by NewFilesFinder.
+type FinderOption func(f *filesFinder)
+
+// WithFileFilter makes the finder skip the files, and the whole dirs, excluded by the filter.
+func WithFileFilter(filter *FileFilter) FinderOption {
+	return func(f *filesFinder) {
+		f.filter = filter
+	}
+}
+
+// WithIgnoreFiles makes the finder honour the ignore files with the given name found in any of the walked dirs.
+// They follow the gitignore syntax, and their rules apply to the files in the same dir and below.
+func WithIgnoreFiles(fileName string) FinderOption {
+	return func(f *filesFinder) {
+		f.ignoreFileName = fileName
+	}
+}
+
+func NewFilesFinder(basedir string, recursive bool, fileExtensions []string, opts ...FinderOption,
 ) FilesFinder {
-	return &filesFinder{
+	f := &filesFinder{
 		basedir:        basedir,
 		recursive:      recursive,
 		fileExtensions: fileExtensions,
 	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
 type filesFinder struct {
 	basedir        string
 	recursive      bool
 	fileExtensions []string
+	filter         *FileFilter
+	ignoreFileName string
 }
 
 func (f *filesFinder) Run(ctx context.Context, filesCh chan<- string) error {
 	defer close(filesCh)
 
-	if err := f.findRecursive(ctx, f.basedir, "", filesCh); err != nil {
+	if err := f.findRecursive(ctx, f.basedir, "", nil, filesCh); err != nil && ctx.Err() == nil {
 		return err
 	}
+	//	cancelled, by whoever cancelled ctx, it is not a failure of the finder
 	return nil
 }
 
-func (f *filesFinder) findRecursive(ctx context.Context, dir string, baseRelativeDir string, filesCh chan<- string) error {
+// findRecursive sends the files found in dir and below, returning the ctx error as soon as ctx is done.
+func (f *filesFinder) findRecursive(ctx context.Context, dir string, baseRelativeDir string, ignores []*ignoreFile, filesCh chan<- string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	files, err := ioutil.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("failed listing files in dir %s: %w", dir, err)
 	}
 
+	if f.ignoreFileName != "" {
+		for _, file := range files {
+			if file.Name() == f.ignoreFileName && !file.IsDir() {
+				ignore, err := readIgnoreFile(filepath.Join(dir, file.Name()), baseRelativeDir)
+				if err != nil {
+					return err
+				}
+				//	copy, so that sibling dirs do not share the rules appended by each other
+				ignores = append(ignores[:len(ignores):len(ignores)], ignore)
+				break
+			}
+		}
+	}
+
 	for _, file := range files {
 		fullFn := filepath.Join(dir, file.Name())
 		baseRelativeName := filepath.Join(baseRelativeDir, file.Name())
+		if isIgnored(ignores, baseRelativeName, file.IsDir()) {
+			continue
+		}
 		if file.IsDir() {
-			if f.recursive {
-				if err := f.findRecursive(ctx, fullFn, baseRelativeName, filesCh); err != nil {
+			if f.recursive && (f.filter == nil || !f.filter.ExcludesDir(baseRelativeName)) {
+				if err := f.findRecursive(ctx, fullFn, baseRelativeName, ignores, filesCh); err != nil {
 					return err
 				}
 			}
 		} else {
-			if f.isFileIncluded(baseRelativeName) {
-				filesCh <- baseRelativeName
+			if file.Name() != f.ignoreFileName && f.isFileIncluded(baseRelativeName) {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case filesCh <- baseRelativeName:
+				}
 			}
 		}
 	}
@@ -61,10 +113,45 @@ func (f *filesFinder) findRecursive(ctx context.Context, dir string, baseRelativ
 }
 
 func (f *filesFinder) isFileIncluded(fileName string) bool {
+	if f.filter != nil && !f.filter.Includes(fileName) {
+		return false
+	}
+
+	//	match whole extensions only, so that pdf does not match notapdf, while still allowing ones like tar.gz
 	for _, extension := range f.fileExtensions {
-		if strings.HasSuffix(fileName, extension) {
+		extension = strings.TrimSpace(extension)
+		if extension == "" {
+			//	-e "" has always meant all the files
+			return true
+		}
+		extension = strings.TrimPrefix(extension, ".")
+		if extension != "" && strings.HasSuffix(fileName, "."+extension) {
 			return true
 		}
 	}
 	return false
 }
+
+// NewListFilesFinder returns a FilesFinder which sends the given base relative file names, without looking at the disk.
+func NewListFilesFinder(fileNames []string) FilesFinder {
+	return &listFilesFinder{
+		fileNames: fileNames,
+	}
+}
+
+type listFilesFinder struct {
+	fileNames []string
+}
+
+func (f *listFilesFinder) Run(ctx context.Context, filesCh chan<- string) error {
+	defer close(filesCh)
+
+	for _, fileName := range f.fileNames {
+		select {
+		case <-ctx.Done():
+			return nil
+		case filesCh <- fileName:
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package ffaac_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+// createDeepTree creates depth nested dirs, with filesPerDir files in each, returning their number.
+func (ti *processorTestInstances) createDeepTree(t *testing.T, depth int, filesPerDir int) int {
+	var fileNames []string
+	dir := ""
+	for d := 0; d < depth; d++ {
+		dir = filepath.Join(dir, fmt.Sprintf("fold%d", d))
+		for i := 0; i < filesPerDir; i++ {
+			fileNames = append(fileNames, filepath.Join(dir, fmt.Sprintf("file%d.pdf", i)))
+		}
+	}
+	ti.createTestFiles(t, fileNames...)
+	return len(fileNames)
+}
+
+// runFinder runs filesFinder with ctx, returning its result once done.
+func runFinder(ctx context.Context, filesFinder ffaac.FilesFinder, filesCh chan<- string) <-chan error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- filesFinder.Run(ctx, filesCh)
+	}()
+	return errCh
+}
+
+func TestFilesFinderStopsWhenCancelledWhileSending(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+	ti.createDeepTree(t, 30, 5)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	filesCh := make(chan string)
+	errCh := runFinder(ctx, ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"}), filesCh)
+
+	for i := 0; i < 3; i++ {
+		<-filesCh
+	}
+	//	nobody reads the files anymore, as when all the workers have stopped
+	cancel()
+
+	select {
+	case err := <-errCh:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the finder did not stop once cancelled")
+	}
+	_, open := <-filesCh
+	assert.False(t, open)
+}
+
+func TestFilesFinderStopsBetweenDirReads(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+	ti.createDeepTree(t, 30, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	//	buffered, so that only checking ctx before reading a dir keeps the files from being sent
+	filesCh := make(chan string, 100)
+	errCh := runFinder(ctx, ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"}), filesCh)
+
+	var found []string
+	for fileName := range filesCh {
+		found = append(found, fileName)
+	}
+	assert.NoError(t, <-errCh)
+	assert.Empty(t, found)
+}
+
+func TestProcessStopsDeepWalkOnError(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+	//	more files than the processor buffers, so that the finder is still walking when the workers stop
+	ti.createDeepTree(t, 50, 10)
+
+	saveErr := status.Error(codes.InvalidArgument, "invalid")
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), gomock.Any()).Return(nil, saveErr).MinTimes(1).MaxTimes(workers)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ti.processor.ProcessFiles(context.Background())
+	}()
+
+	select {
+	case err := <-errCh:
+		assert.True(t, errors.Is(err, saveErr))
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProcessFiles did not return after a worker failed")
+	}
+}
+
+func TestProcessDrainStopsDeepWalk(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+	total := ti.createDeepTree(t, 50, 10)
+
+	started := make(chan struct{}, total)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+			started <- struct{}{}
+			time.Sleep(20 * time.Millisecond)
+			return &emptypb.Empty{}, nil
+		}).AnyTimes()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ti.processor.ProcessFiles(context.Background())
+	}()
+	<-started
+	ti.processor.Drain(0)
+
+	require.True(t, errors.Is(<-errCh, ffaac.ErrDrained))
+	//	at most the files buffered by the processor, and the ones the workers had picked up
+	unprocessed := ti.processor.Unprocessed()
+	assert.NotEmpty(t, unprocessed)
+	assert.Less(t, len(unprocessed)+len(started), total)
+}
@@ -2,6 +2,10 @@ package ffaac
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
@@ -13,41 +17,276 @@ type FilesProcessor struct {
 	basedir          string
 	workers          int
 	filesFinder      FilesFinder
+	journal          *Journal
+	failures         *failureCollector
+	idMapper         IDMapper
+	skipExisting     bool
+	overwriteChanged bool
+	runTimeout       time.Duration
+	minWorkers       int
+	maxLatency       time.Duration
+	counters         processorCounters
+	metrics          *Metrics
+	drainer          *drainer
+	unprocessed      fileList
 }
 
-func NewFileProcessor(faaClient bfaa.BillFulfilmentArchiveAPIClient, basedir string, workers int, filesFinder FilesFinder) *FilesProcessor {
-	return &FilesProcessor{
+// processorCounters are updated by all the workers of the FilesProcessor.
+type processorCounters struct {
+	skipped      int64
+	retriedFiles int64
+	retries      int64
+}
+
+// ProcessorOption configures optional behaviours of the FilesProcessor.
+type ProcessorOption func(p *FilesProcessor)
+
+// WithJournal makes the processor record every file successfully saved in the journal.
+func WithJournal(journal *Journal) ProcessorOption {
+	return func(p *FilesProcessor) {
+		p.journal = journal
+	}
+}
+
+// WithContinueOnError makes the processor carry on with the other files when a file cannot be saved,
+// instead of stopping at the first failure. The failures are available from FailureReport once ProcessFiles returns.
+func WithContinueOnError() ProcessorOption {
+	return func(p *FilesProcessor) {
+		p.failures = &failureCollector{}
+	}
+}
+
+// WithIDMapper makes the processor save the files under the IDs given by idMapper, rather than their base relative paths.
+func WithIDMapper(idMapper IDMapper) ProcessorOption {
+	return func(p *FilesProcessor) {
+		p.idMapper = idMapper
+	}
+}
+
+// WithSkipExisting makes the processor look up every file in the archive before saving it, and skip the ones already there.
+// With overwriteChanged the files already archived are only skipped if their content is the same, and saved again otherwise.
+func WithSkipExisting(overwriteChanged bool) ProcessorOption {
+	return func(p *FilesProcessor) {
+		p.skipExisting = true
+		p.overwriteChanged = overwriteChanged
+	}
+}
+
+// WithMetrics makes the processor count the files it processes in metrics.
+func WithMetrics(metrics *Metrics) ProcessorOption {
+	return func(p *FilesProcessor) {
+		p.metrics = metrics
+	}
+}
+
+// WithRunTimeout makes ProcessFiles stop, returning ErrRunTimeout, once the run has taken longer than timeout.
+// The files being saved then fail with a timeout, and the ones found but not picked up yet are listed by Unprocessed.
+func WithRunTimeout(timeout time.Duration) ProcessorOption {
+	return func(p *FilesProcessor) {
+		p.runTimeout = timeout
+	}
+}
+
+// WithAdaptiveConcurrency makes the processor vary the number of files uploaded at once between minWorkers and its workers,
+// starting from minWorkers. It goes up while the saves succeed within maxLatency, and is halved whenever the archive api
+// rejects a save because it is overloaded, with ResourceExhausted or Unavailable, or an attempt of a save takes longer
+// than maxLatency, per MiB for the files larger than 1 MiB. A zero maxLatency only reacts to the overloaded errors.
+// The attempts are timed by the AttemptsCounterInterceptor, without it the whole saves, retries included, are.
+func WithAdaptiveConcurrency(minWorkers int, maxLatency time.Duration) ProcessorOption {
+	return func(p *FilesProcessor) {
+		p.minWorkers = minWorkers
+		p.maxLatency = maxLatency
+	}
+}
+
+// ErrRunTimeout is returned by the FilesProcessor when the run does not complete within the WithRunTimeout timeout.
+var ErrRunTimeout = errors.New("run timed out")
+
+func NewFileProcessor(faaClient bfaa.BillFulfilmentArchiveAPIClient, basedir string, workers int, filesFinder FilesFinder, opts ...ProcessorOption) *FilesProcessor {
+	p := &FilesProcessor{
 		archiveAPIClient: faaClient,
 		basedir:          basedir,
 		workers:          workers,
 		filesFinder:      filesFinder,
+		idMapper:         pathIDMapper{},
+		drainer:          newDrainer(),
+	}
+	for _, opt := range opts {
+		opt(p)
 	}
+	return p
 }
 
 func (p *FilesProcessor) ProcessFiles(parentCtx context.Context) error {
 	fileCh := make(chan string, 100)
 
-	wg, ctx := errgroup.WithContext(parentCtx)
+	runCtx := parentCtx
+	if p.runTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(parentCtx, p.runTimeout)
+		defer cancel()
+	}
+
+	findCtx, stopFinding := context.WithCancel(runCtx)
+	defer stopFinding()
+	wg, ctx := errgroup.WithContext(findCtx)
+	//	the uploads are only cancelled once draining takes too long, while new files stop being picked up straight away
+	uploadCtx, abortUploads := context.WithCancel(ctx)
+	defer abortUploads()
+	pickCtx, stopPicking := context.WithCancel(uploadCtx)
+	defer stopPicking()
 
-	wg.Go(func() error {
-		return p.filesFinder.Run(ctx, fileCh)
-	})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-p.drainer.draining:
+		}
+		stopPicking()
+		if p.drainer.timeout > 0 {
+			abort := time.AfterFunc(p.drainer.timeout, func() {
+				p.drainer.abort()
+				abortUploads()
+			})
+			<-done
+			abort.Stop()
+		}
+	}()
+
+	var concurrency *concurrencyLimiter
+	if p.minWorkers > 0 {
+		concurrency = newConcurrencyLimiter(p.minWorkers, p.workers, p.maxLatency, p.metrics)
+	}
+
+	//	not in the group, as the finder may be blocked reading its input after the workers stopped
+	finderDone := make(chan error, 1)
+	go func() {
+		err := p.filesFinder.Run(pickCtx, fileCh)
+		//	sent before stopping the workers, so that the error is there once they have stopped
+		finderDone <- err
+		if err != nil {
+			stopFinding()
+		}
+	}()
 
 	for i := 0; i < p.workers; i++ {
 		w := &fileSaverWorker{
 			faaClient: p.archiveAPIClient,
 			fileChan:  fileCh,
 			basedir:   p.basedir,
+			journal:   p.journal,
+			failures:  p.failures,
+			idMapper:  p.idMapper,
+
+			skipExisting:     p.skipExisting,
+			overwriteChanged: p.overwriteChanged,
+			counters:         &p.counters,
+			metrics:          p.metrics,
+			concurrency:      concurrency,
+			unprocessed:      &p.unprocessed,
+			drainer:          p.drainer,
 		}
 		wg.Go(func() error {
-			return w.Run(ctx)
+			return w.Run(pickCtx, uploadCtx)
 		})
 	}
 
-	if err := wg.Wait(); err != nil {
+	err := wg.Wait()
+	var findErr error
+	if pickCtx.Err() == nil {
+		//	the workers have picked up all the files, so the finder is done
+		findErr = <-finderDone
+	} else {
+		select {
+		case findErr = <-finderDone:
+		default:
+		}
+		if p.drainer.drained() || runCtx.Err() == context.DeadlineExceeded {
+			p.listQueued(fileCh)
+		}
+	}
+	if err == nil {
+		err = findErr
+	}
+	unprocessed := p.Unprocessed()
+	if len(unprocessed) > 0 {
+		logrus.WithField("files", unprocessed).Warnf("%d files left unprocessed", len(unprocessed))
+	}
+	if runCtx.Err() == context.DeadlineExceeded && parentCtx.Err() == nil {
+		return fmt.Errorf("run did not complete within %v: %w", p.runTimeout, ErrRunTimeout)
+	}
+	if err != nil {
 		return err
 	}
 
-	logrus.Infof("Processing ended")
+	summary := "Processing ended"
+	if p.drainer.drained() {
+		summary = fmt.Sprintf("Processing stopped, %d files left unprocessed", len(unprocessed))
+	}
+	if p.skipExisting {
+		summary += fmt.Sprintf(", %d files already archived skipped", p.Skipped())
+	}
+	if retriedFiles, retries := p.Retries(); retriedFiles > 0 {
+		summary += fmt.Sprintf(", %d files needed %d retries", retriedFiles, retries)
+	}
+
+	if p.failures != nil {
+		if failures := p.failures.list(); len(failures) > 0 {
+			logrus.Errorf("%s, %d files failed", summary, len(failures))
+			return fmt.Errorf("%d files could not be saved: %w", len(failures), ErrFilesFailed)
+		}
+	}
+
+	if p.drainer.drained() {
+		logrus.Warn(summary)
+		return fmt.Errorf("%d files left unprocessed: %w", len(unprocessed), ErrDrained)
+	}
+
+	logrus.Info(summary)
 	return nil
 }
+
+// listQueued adds the files found but not picked up by the workers to the unprocessed ones, without waiting for more.
+func (p *FilesProcessor) listQueued(fileCh <-chan string) {
+	for {
+		select {
+		case fn, ok := <-fileCh:
+			if !ok {
+				return
+			}
+			p.unprocessed.add(fn)
+		default:
+			return
+		}
+	}
+}
+
+// Skipped returns the number of files which were not saved because already archived, with WithSkipExisting.
+func (p *FilesProcessor) Skipped() int {
+	return int(atomic.LoadInt64(&p.counters.skipped))
+}
+
+// Retries returns the number of files whose save was retried, whether it eventually succeeded or not,
+// and the total number of retries.
+func (p *FilesProcessor) Retries() (files int, retries int) {
+	return int(atomic.LoadInt64(&p.counters.retriedFiles)), int(atomic.LoadInt64(&p.counters.retries))
+}
+
+// FailureReport returns the files which could not be saved, in continue on error mode,
+// followed by the ones left unprocessed, so that they can all be uploaded again from the report.
+func (p *FilesProcessor) FailureReport() *FailureReport {
+	report := &FailureReport{Basedir: p.basedir, Failures: []FileFailure{}}
+	if p.failures != nil {
+		report.Failures = p.failures.list()
+	}
+	for _, fileName := range p.Unprocessed() {
+		report.Failures = append(report.Failures, FileFailure{
+			Path:    fileName,
+			Reason:  FailureReasonUnprocessed,
+			Message: "left unprocessed when the processing was stopped",
+		})
+	}
+	return report
+}
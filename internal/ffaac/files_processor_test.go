@@ -15,6 +15,8 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/emptypb"
 
@@ -161,6 +163,294 @@ func TestProcessStopOnError(t *testing.T) {
 	assert.Equal(t, 1, saveCalled)
 }
 
+func TestProcessContinueOnError(t *testing.T) {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", "two.pdf", "three.pdf"}
+	ti.createTestFiles(t, fileNames...)
+
+	ti.processor = ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, ti.mockFilesFinder, ffaac.WithContinueOnError())
+
+	ti.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			for _, fileName := range append(fileNames, "missing.pdf") {
+				filesCh <- fileName
+			}
+			close(filesCh)
+			return nil
+		})
+
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("one.pdf")).Return(nil, nil).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("two.pdf")).
+		Return(nil, status.Error(codes.Unavailable, "unavailable")).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("three.pdf")).Return(nil, nil).Times(1)
+
+	err := ti.processor.ProcessFiles(context.Background())
+	assert.True(t, errors.Is(err, ffaac.ErrFilesFailed))
+
+	report := ti.processor.FailureReport()
+	assert.Equal(t, ti.basedir, report.Basedir)
+	require.Len(t, report.Failures, 2)
+
+	assert.Equal(t, "missing.pdf", report.Failures[0].Path)
+	assert.Equal(t, ffaac.FailureReasonRead, report.Failures[0].Reason)
+	assert.Empty(t, report.Failures[0].Code)
+	assert.Equal(t, 0, report.Failures[0].Attempts)
+
+	assert.Equal(t, ffaac.FileFailure{
+		Path:     "two.pdf",
+		Reason:   ffaac.FailureReasonAPI,
+		Code:     "Unavailable",
+		Message:  "rpc error: code = Unavailable desc = unavailable",
+		Attempts: 1,
+	}, report.Failures[1])
+}
+
+// retryingSave returns a SaveBillFulfilmentArchive which behaves as if it were retried by a retrying interceptor,
+// making one attempt per error in errs, until one succeeds.
+func retryingSave(errs ...error) func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	return func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+		var err error
+		for _, attemptErr := range errs {
+			err = ffaac.AttemptsCounterInterceptor(ctx, "Save", in, nil, nil,
+				func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+					return attemptErr
+				})
+			if err == nil {
+				break
+			}
+		}
+		return &emptypb.Empty{}, err
+	}
+}
+
+func TestProcessCountsRetries(t *testing.T) {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", "two.pdf", "three.pdf"}
+	ti.createTestFiles(t, fileNames...)
+
+	ti.processor = ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, ti.mockFilesFinder, ffaac.WithContinueOnError())
+
+	ti.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			for _, fileName := range fileNames {
+				filesCh <- fileName
+			}
+			close(filesCh)
+			return nil
+		})
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("one.pdf")).
+		DoAndReturn(retryingSave(nil)).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("two.pdf")).
+		DoAndReturn(retryingSave(unavailable, nil)).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("three.pdf")).
+		DoAndReturn(retryingSave(unavailable, unavailable, unavailable)).Times(1)
+
+	assert.True(t, errors.Is(ti.processor.ProcessFiles(context.Background()), ffaac.ErrFilesFailed))
+
+	files, retries := ti.processor.Retries()
+	assert.Equal(t, 2, files)
+	assert.Equal(t, 3, retries)
+
+	report := ti.processor.FailureReport()
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, 3, report.Failures[0].Attempts)
+}
+
+func TestProcessRecordsTimeouts(t *testing.T) {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", "two.pdf"}
+	ti.createTestFiles(t, fileNames...)
+
+	ti.processor = ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, ti.mockFilesFinder, ffaac.WithContinueOnError())
+
+	ti.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			for _, fileName := range fileNames {
+				filesCh <- fileName
+			}
+			close(filesCh)
+			return nil
+		})
+
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("one.pdf")).
+		Return(nil, status.Error(codes.DeadlineExceeded, "context deadline exceeded")).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("two.pdf")).
+		Return(nil, status.Error(codes.Internal, "internal")).Times(1)
+
+	assert.True(t, errors.Is(ti.processor.ProcessFiles(context.Background()), ffaac.ErrFilesFailed))
+
+	report := ti.processor.FailureReport()
+	require.Len(t, report.Failures, 2)
+	assert.Equal(t, ffaac.FailureReasonTimeout, report.Failures[0].Reason)
+	assert.Equal(t, "DeadlineExceeded", report.Failures[0].Code)
+	assert.Equal(t, ffaac.FailureReasonAPI, report.Failures[1].Reason)
+}
+
+func TestProcessRunTimeout(t *testing.T) {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+
+	ti.createTestFiles(t, "one.pdf")
+
+	ti.processor = ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, ti.mockFilesFinder,
+		ffaac.WithContinueOnError(), ffaac.WithRunTimeout(50*time.Millisecond))
+
+	ti.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			filesCh <- "one.pdf"
+			//	more files to find than time to find them
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("one.pdf")).DoAndReturn(
+		func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+			<-ctx.Done()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}).Times(1)
+
+	err := ti.processor.ProcessFiles(context.Background())
+	assert.True(t, errors.Is(err, ffaac.ErrRunTimeout))
+
+	report := ti.processor.FailureReport()
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, "one.pdf", report.Failures[0].Path)
+	assert.Equal(t, ffaac.FailureReasonTimeout, report.Failures[0].Reason)
+}
+
+func TestProcessRunTimeoutListsQueuedFiles(t *testing.T) {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", "two.pdf", "three.pdf", "four.pdf"}
+	ti.createTestFiles(t, fileNames...)
+
+	ti.processor = ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, 1, ti.mockFilesFinder,
+		ffaac.WithContinueOnError(), ffaac.WithRunTimeout(50*time.Millisecond))
+
+	ti.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			for _, fileName := range fileNames {
+				filesCh <- fileName
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("one.pdf")).DoAndReturn(
+		func(ctx context.Context, in *bfaa.SaveBillFulfilmentArchiveRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+			<-ctx.Done()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}).Times(1)
+
+	err := ti.processor.ProcessFiles(context.Background())
+	assert.True(t, errors.Is(err, ffaac.ErrRunTimeout))
+	assert.Equal(t, []string{"four.pdf", "three.pdf", "two.pdf"}, ti.processor.Unprocessed())
+
+	report := ti.processor.FailureReport()
+	require.Len(t, report.Failures, 4)
+	assert.Equal(t, "one.pdf", report.Failures[0].Path)
+	assert.Equal(t, ffaac.FailureReasonTimeout, report.Failures[0].Reason)
+	for _, failure := range report.Failures[1:] {
+		assert.Equal(t, ffaac.FailureReasonUnprocessed, failure.Reason, failure.Path)
+	}
+}
+
+func TestProcessRetryFailuresFromReport(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", filepath.Join("fold1", "two.pdf"), filepath.Join("fold1", "three.pdf")}
+	ti.createTestFiles(t, fileNames...)
+
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileNames[0])).Return(nil, nil).Times(1)
+	for _, fileName := range fileNames[1:] {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).
+			Return(nil, status.Error(codes.Internal, "internal")).Times(1)
+	}
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithContinueOnError())
+	assert.True(t, errors.Is(processor.ProcessFiles(context.Background()), ffaac.ErrFilesFailed))
+
+	reportPath := filepath.Join(t.TempDir(), "failure-report.json")
+	require.NoError(t, processor.FailureReport().WriteFile(reportPath))
+
+	report, err := ffaac.ReadFailureReport(reportPath)
+	require.NoError(t, err)
+	assert.Equal(t, ti.basedir, report.Basedir)
+	assert.Equal(t, []string{filepath.Join("fold1", "three.pdf"), filepath.Join("fold1", "two.pdf")}, report.Paths())
+
+	// only the failed files are sent again
+	for _, fileName := range fileNames[1:] {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+	processor = ffaac.NewFileProcessor(ti.mockArchiveAPIClient, report.Basedir, workers, ffaac.NewListFilesFinder(report.Paths()), ffaac.WithContinueOnError())
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+	assert.Empty(t, processor.FailureReport().Failures)
+}
+
+func TestProcessSkipExisting(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, "archived.pdf", "new.pdf")
+
+	ti.expectArchive("archived.pdf", "different content")
+	ti.mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.GetBillFulfilmentArchiveRequest{Id: "new.pdf"})).
+		Return(nil, status.Error(codes.NotFound, "not found")).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("new.pdf")).Return(nil, nil).Times(1)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithSkipExisting(false))
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+	assert.Equal(t, 1, processor.Skipped())
+}
+
+func TestProcessSkipExistingOverwriteChanged(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, "same.pdf", "changed.pdf")
+
+	ti.expectArchive("same.pdf", "same.pdf")
+	ti.expectArchive("changed.pdf", "different content")
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("changed.pdf")).Return(nil, nil).Times(1)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithSkipExisting(true))
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+	assert.Equal(t, 1, processor.Skipped())
+}
+
+func TestProcessSkipExistingLookupError(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, "one.pdf")
+
+	ti.mockArchiveAPIClient.EXPECT().GetBillFulfilmentArchive(gomock.Any(), gomock.Any()).
+		Return(nil, status.Error(codes.Unavailable, "unavailable")).Times(1)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder,
+		ffaac.WithSkipExisting(false), ffaac.WithContinueOnError())
+	assert.True(t, errors.Is(processor.ProcessFiles(context.Background()), ffaac.ErrFilesFailed))
+
+	report := processor.FailureReport()
+	require.Len(t, report.Failures, 1)
+	assert.Equal(t, ffaac.FailureReasonAPI, report.Failures[0].Reason)
+	assert.Equal(t, "Unavailable", report.Failures[0].Code)
+}
+
 func TestProcessWithChildDirsRecursive(t *testing.T) {
 	ti := initProcessorWithRealFinder(t, true, "pdf")
 	defer ti.finish()
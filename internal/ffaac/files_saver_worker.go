@@ -2,29 +2,77 @@ package ffaac
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+	"google.golang.org/grpc/codes"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
 )
 
 type fileSaverWorker struct {
 	faaClient bfaa.BillFulfilmentArchiveAPIClient
 	fileChan  <-chan string
 	basedir   string
+	journal   *Journal
+	failures  *failureCollector
+	idMapper  IDMapper
+
+	skipExisting     bool
+	overwriteChanged bool
+	counters         *processorCounters
+	metrics          *Metrics
+	concurrency      *concurrencyLimiter
+	unprocessed      *fileList
+	drainer          *drainer
 }
 
-func (f *fileSaverWorker) Run(ctx context.Context) error {
+// Run saves the files received until pickCtx is done, making the calls with uploadCtx,
+// so that the files already picked up can still complete when no more are to be.
+func (f *fileSaverWorker) Run(pickCtx context.Context, uploadCtx context.Context) error {
 	for {
 		select {
-		case <-ctx.Done():
+		case <-pickCtx.Done():
 			return nil
 		case fn, ok := <-f.fileChan:
+			if ok && pickCtx.Err() != nil {
+				//	select picks randomly when both are ready, do not start on a file once stopped
+				f.unprocessed.add(fn)
+				return nil
+			}
 			if ok {
-				if err := f.sendFileToArchiveAPI(ctx, fn); err != nil {
+				f.metrics.fileDiscovered()
+				if err := f.concurrency.acquire(pickCtx); err != nil {
+					f.unprocessed.add(fn)
+					return nil
+				}
+				err := f.sendFileToArchiveAPI(uploadCtx, fn)
+				f.concurrency.release()
+				if err != nil && uploadCtx.Err() != nil && f.drainer.aborted() {
+					//	cancelled because draining timed out, to be uploaded again like the files not picked up
+					logrus.WithError(err).Warnf("Upload of file %s cancelled", fn)
+					f.unprocessed.add(fn)
+					continue
+				}
+				if err != nil {
+					var fileErr *FileError
+					if errors.As(err, &fileErr) {
+						f.metrics.fileFailed(fileErr.Reason)
+					}
+					if f.failures != nil && fileErr != nil {
+						logrus.WithError(err).Errorf("Failed saving file %s, continuing", fn)
+						f.failures.add(fileErr)
+						continue
+					}
 					return err
 				}
 			} else {
@@ -36,9 +84,33 @@ func (f *fileSaverWorker) Run(ctx context.Context) error {
 
 func (f *fileSaverWorker) sendFileToArchiveAPI(ctx context.Context, fileName string) error {
 	logrus.Infof("Processing file %s", fileName)
+	id, err := f.idMapper.ID(fileName)
+	if err != nil {
+		return &FileError{Path: fileName, Reason: FailureReasonID, Err: err, msg: fmt.Sprintf("failed building the id of file %s", fileName)}
+	}
+
+	var archived *bfaa.BillFulfilmentArchive
+	if f.skipExisting {
+		callCtx, attempts := withAttemptsCounter(fileCallContext(ctx, fileName, id))
+		resp, err := f.faaClient.GetBillFulfilmentArchive(callCtx, &bfaa.GetBillFulfilmentArchiveRequest{Id: id})
+		switch {
+		case grpcCode(err) == codes.NotFound:
+			//	not archived yet, save it
+		case err != nil:
+			return apiFileError(fileName, attempts, err, fmt.Sprintf("failed looking up file %s in the fulfilment archive api", fileName))
+		case !f.overwriteChanged:
+			logrus.Infof("Skipping file %s, already archived as %s", fileName, id)
+			atomic.AddInt64(&f.counters.skipped, 1)
+			f.metrics.fileSkipped()
+			return nil
+		default:
+			archived = resp.GetArchive()
+		}
+	}
+
 	file, err := os.Open(filepath.Join(f.basedir, fileName))
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", fileName, err)
+		return &FileError{Path: fileName, Reason: FailureReasonRead, Err: err, msg: fmt.Sprintf("failed to open file %s", fileName)}
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
@@ -48,15 +120,75 @@ func (f *fileSaverWorker) sendFileToArchiveAPI(ctx context.Context, fileName str
 
 	bytes, err := io.ReadAll(file)
 	if err != nil {
-		return fmt.Errorf("failed reading bytes for file %s: %w", fileName, err)
+		return &FileError{Path: fileName, Reason: FailureReasonRead, Err: err, msg: fmt.Sprintf("failed reading bytes for file %s", fileName)}
 	}
 
-	_, err = f.faaClient.SaveBillFulfilmentArchive(ctx, &bfaa.SaveBillFulfilmentArchiveRequest{
-		Id:      fileName,
+	if archived != nil {
+		if sha256.Sum256(bytes) == sha256.Sum256(archived.GetData()) {
+			logrus.Infof("Skipping file %s, already archived as %s with the same content", fileName, id)
+			atomic.AddInt64(&f.counters.skipped, 1)
+			f.metrics.fileSkipped()
+			return nil
+		}
+		logrus.Infof("File %s changed since archived as %s, saving it again", fileName, id)
+	}
+
+	callCtx, attempts := withAttemptsCounter(fileCallContext(ctx, fileName, id))
+	start := time.Now()
+	_, err = f.faaClient.SaveBillFulfilmentArchive(callCtx, &bfaa.SaveBillFulfilmentArchiveRequest{
+		Id:      id,
 		Archive: &bfaa.BillFulfilmentArchive{Data: bytes},
 	})
+	latency := time.Since(start)
+	f.metrics.uploadCalled(latency)
+	attemptLatency := attempts.slowestAttempt()
+	if attempts.attempts() == 0 {
+		//	no attempts counter interceptor installed, the call has been a single attempt
+		attemptLatency = normalisedLatency(latency, len(bytes))
+	}
+	f.concurrency.record(start, attemptLatency, attempts.overloadedAttempts() > 0 || isOverloaded(err), err)
+	if n := attempts.attempts(); n > 1 {
+		atomic.AddInt64(&f.counters.retriedFiles, 1)
+		atomic.AddInt64(&f.counters.retries, int64(n-1))
+		if err == nil {
+			logrus.Infof("File %s saved after %d attempts", fileName, n)
+		}
+	}
 	if err != nil {
-		return fmt.Errorf("failed calling the fulfilment archive api for file %s: %w", fileName, err)
+		return apiFileError(fileName, attempts, err, fmt.Sprintf("failed calling the fulfilment archive api for file %s", fileName))
+	}
+	f.metrics.fileUploaded(len(bytes))
+
+	if f.journal != nil {
+		sum := sha256.Sum256(bytes)
+		if err := f.journal.Record(JournalEntry{
+			ID:     id,
+			Path:   fileName,
+			Size:   int64(len(bytes)),
+			SHA256: hex.EncodeToString(sum[:]),
+			Time:   time.Now().UTC(),
+		}); err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+// fileCallContext returns the context of a call made for the file fileName, saved as id,
+// so that the interceptors can log which file their call is for.
+func fileCallContext(ctx context.Context, fileName string, id string) context.Context {
+	ctx = grpcclient.ContextWithLogFields(ctx, logrus.Fields{"file": fileName, "archive_id": id})
+	return contextWithFilePath(ctx, fileName)
+}
+
+func apiFileError(fileName string, attempts *callAttempts, err error, msg string) *FileError {
+	fileErr := &FileError{Path: fileName, Reason: FailureReasonAPI, Attempts: attempts.attempts(), Err: err, msg: msg}
+	if grpcCode(err) == codes.DeadlineExceeded || errors.Is(err, context.DeadlineExceeded) {
+		fileErr.Reason = FailureReasonTimeout
+	}
+	if fileErr.Attempts == 0 {
+		//	no attempts counter interceptor installed, the call has been made at least once
+		fileErr.Attempts = 1
+	}
+	return fileErr
+}
@@ -0,0 +1,172 @@
+package ffaac
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// IDMapper derives the archive ID of a file from its path relative to the base dir.
+type IDMapper interface {
+	ID(fileName string) (string, error)
+}
+
+// NewPathIDMapper returns an IDMapper using the base relative path as it is, which is what the FilesProcessor does by default.
+func NewPathIDMapper() IDMapper {
+	return pathIDMapper{}
+}
+
+type pathIDMapper struct{}
+
+func (pathIDMapper) ID(fileName string) (string, error) {
+	return fileName, nil
+}
+
+var templatePlaceholder = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// NewTemplateIDMapper returns an IDMapper building IDs from a template with {placeholders}:
+//
+//	{path}  the / separated path relative to the base dir, after removing the stripPrefix dirs
+//	{dir}   the dir of {path}, empty for files in the base dir
+//	{base}  the file name
+//	{stem}  the file name without its extension
+//	{ext}   the extension, without the dot
+//	{1}...  the groups captured by pattern, matched against {path}; named groups are available as {name} too
+//
+// stripPrefix is only removed as whole path segments, so that out/2023 is removed from out/2023/01 but not from out/20230.
+// The ID is prefixed by prefix. Repeated or leading / in the result are dropped, so that {dir}/{base}
+// gives a clean ID for files in the base dir too.
+func NewTemplateIDMapper(template string, pattern string, prefix string, stripPrefix string) (IDMapper, error) {
+	m := &templateIDMapper{
+		template:    template,
+		prefix:      prefix,
+		stripPrefix: strings.Trim(filepath.ToSlash(stripPrefix), "/"),
+	}
+
+	groups := map[string]bool{}
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id regex %q: %w", pattern, err)
+		}
+		m.re = re
+		for i, name := range re.SubexpNames() {
+			if i > 0 {
+				groups[strconv.Itoa(i)] = true
+			}
+			if name != "" {
+				groups[name] = true
+			}
+		}
+	}
+
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(template, -1) {
+		switch name := match[1]; name {
+		case "path", "dir", "base", "stem", "ext":
+		default:
+			if !groups[name] {
+				return nil, fmt.Errorf("unknown placeholder {%s} in id template %q", name, template)
+			}
+		}
+	}
+	return m, nil
+}
+
+type templateIDMapper struct {
+	template    string
+	re          *regexp.Regexp
+	prefix      string
+	stripPrefix string
+}
+
+func (m *templateIDMapper) ID(fileName string) (string, error) {
+	p := strings.TrimPrefix(filepath.ToSlash(fileName), "/")
+	if m.stripPrefix != "" {
+		if p == m.stripPrefix {
+			p = ""
+		} else if strings.HasPrefix(p, m.stripPrefix+"/") {
+			p = p[len(m.stripPrefix)+1:]
+		}
+	}
+
+	base := path.Base(p)
+	ext := path.Ext(base)
+	dir := path.Dir(p)
+	if dir == "." {
+		dir = ""
+	}
+	values := map[string]string{
+		"path": p,
+		"dir":  dir,
+		"base": base,
+		"stem": strings.TrimSuffix(base, ext),
+		"ext":  strings.TrimPrefix(ext, "."),
+	}
+
+	if m.re != nil {
+		match := m.re.FindStringSubmatch(p)
+		if match == nil {
+			return "", fmt.Errorf("file %s does not match the id regex %s", fileName, m.re)
+		}
+		for i, name := range m.re.SubexpNames() {
+			if i == 0 {
+				continue
+			}
+			values[strconv.Itoa(i)] = match[i]
+			if name != "" {
+				values[name] = match[i]
+			}
+		}
+	}
+
+	id := templatePlaceholder.ReplaceAllStringFunc(m.template, func(placeholder string) string {
+		return values[placeholder[1:len(placeholder)-1]]
+	})
+
+	var segments []string
+	for _, segment := range strings.Split(id, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	id = m.prefix + strings.Join(segments, "/")
+	if id == "" {
+		return "", fmt.Errorf("empty id for file %s", fileName)
+	}
+	return id, nil
+}
+
+// PreviewIDs writes to w, for every file sent by filesFinder, a line with its base relative path and its ID separated by a tab.
+func PreviewIDs(ctx context.Context, filesFinder FilesFinder, idMapper IDMapper, w io.Writer) error {
+	filesCh := make(chan string, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- filesFinder.Run(ctx, filesCh)
+	}()
+
+	var previewErr error
+	for fileName := range filesCh {
+		if previewErr != nil {
+			//	keep draining so that the finder can terminate
+			continue
+		}
+		id, err := idMapper.ID(fileName)
+		if err != nil {
+			previewErr = err
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", fileName, id); err != nil {
+			previewErr = fmt.Errorf("failed writing the id preview: %w", err)
+		}
+	}
+
+	if err := <-errCh; err != nil {
+		return err
+	}
+	return previewErr
+}
@@ -0,0 +1,99 @@
+package ffaac_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestTemplateIDMapper(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		template    string
+		pattern     string
+		prefix      string
+		stripPrefix string
+		fileName    string
+		expectedID  string
+	}{
+		{name: "path", template: "{path}", fileName: filepath.Join("2023", "01", "bill.pdf"), expectedID: "2023/01/bill.pdf"},
+		{name: "parts", template: "{dir}/{stem}.{ext}", fileName: filepath.Join("2023", "bill.tar.gz"), expectedID: "2023/bill.tar.gz"},
+		{name: "empty dir", template: "{dir}/{base}", fileName: "bill.pdf", expectedID: "bill.pdf"},
+		{name: "dot dir", template: "{dir}/{base}", fileName: filepath.Join(".hidden", "bill.pdf"), expectedID: ".hidden/bill.pdf"},
+		{name: "nested dot dir", template: "{dir}/{base}", fileName: filepath.Join("2023", ".drafts", "bill.pdf"), expectedID: "2023/.drafts/bill.pdf"},
+		{name: "prefix", template: "{stem}", prefix: "bills/", fileName: filepath.Join("2023", "bill.pdf"), expectedID: "bills/bill"},
+		{name: "strip prefix", template: "{path}", stripPrefix: "out/2023", fileName: filepath.Join("out", "2023", "01", "bill.pdf"), expectedID: "01/bill.pdf"},
+		{name: "strip prefix dir", template: "{path}", stripPrefix: "out/2023/", fileName: filepath.Join("out", "2023", "01", "bill.pdf"), expectedID: "01/bill.pdf"},
+		{name: "strip prefix within segment", template: "{path}", stripPrefix: "out/2023", fileName: filepath.Join("out", "20230", "bill.pdf"), expectedID: "out/20230/bill.pdf"},
+		{name: "numbered groups", template: "{2}/{1}", pattern: `^(\d+)/bill-(\d+)\.pdf$`, fileName: filepath.Join("2023", "bill-42.pdf"), expectedID: "42/2023"},
+		{name: "named groups", template: "acc-{account}", pattern: `(?P<account>\d+)\.pdf$`, fileName: filepath.Join("x", "123.pdf"), expectedID: "acc-123"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idMapper, err := ffaac.NewTemplateIDMapper(tc.template, tc.pattern, tc.prefix, tc.stripPrefix)
+			require.NoError(t, err)
+
+			id, err := idMapper.ID(tc.fileName)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedID, id)
+		})
+	}
+}
+
+func TestTemplateIDMapperErrors(t *testing.T) {
+	_, err := ffaac.NewTemplateIDMapper("{unknown}", "", "", "")
+	assert.Error(t, err)
+
+	_, err = ffaac.NewTemplateIDMapper("{2}", `(\d+)`, "", "")
+	assert.Error(t, err)
+
+	_, err = ffaac.NewTemplateIDMapper("{1}", `(`, "", "")
+	assert.Error(t, err)
+
+	idMapper, err := ffaac.NewTemplateIDMapper("{1}", `^(\d+)\.pdf$`, "", "")
+	require.NoError(t, err)
+	_, err = idMapper.ID("not-a-number.pdf")
+	assert.Error(t, err)
+}
+
+func TestProcessWithIDTemplate(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	ti.createTestFiles(t, filepath.Join("2023", "01", "bill-1.pdf"), filepath.Join("2023", "02", "bill-2.pdf"))
+
+	for fileName, id := range map[string]string{
+		filepath.Join("2023", "01", "bill-1.pdf"): "bills/2023/bill-1",
+		filepath.Join("2023", "02", "bill-2.pdf"): "bills/2023/bill-2",
+	} {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.SaveBillFulfilmentArchiveRequest{
+			Id:      id,
+			Archive: &bfaa.BillFulfilmentArchive{Data: []byte(fileName)},
+		})).Return(nil, nil).Times(1)
+	}
+
+	idMapper, err := ffaac.NewTemplateIDMapper("{1}/{stem}", `^(\d{4})/`, "bills/", "")
+	require.NoError(t, err)
+
+	filesFinder := ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"})
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithIDMapper(idMapper))
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
+
+func TestPreviewIDs(t *testing.T) {
+	idMapper, err := ffaac.NewTemplateIDMapper("{stem}", "", "bills/", "")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	filesFinder := ffaac.NewListFilesFinder([]string{"one.pdf", filepath.Join("fold1", "two.pdf")})
+	err = ffaac.PreviewIDs(context.Background(), filesFinder, idMapper, &out)
+	require.NoError(t, err)
+	assert.Equal(t, "one.pdf\tbills/one\n"+filepath.Join("fold1", "two.pdf")+"\tbills/two\n", out.String())
+}
@@ -0,0 +1,258 @@
+package ffaac
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// JournalEntry records a file successfully saved to the fulfilment archive.
+type JournalEntry struct {
+	ID     string    `json:"id"`
+	Path   string    `json:"path"`
+	Size   int64     `json:"size"`
+	SHA256 string    `json:"sha256"`
+	Time   time.Time `json:"time"`
+}
+
+var errJournalReadOnly = errors.New("journal opened read only")
+
+// Journal is an append-only JSON lines file recording every file saved, so that an interrupted run can be resumed.
+type Journal struct {
+	mu    sync.Mutex
+	file  *os.File
+	saved map[string]JournalEntry
+}
+
+// OpenJournal loads the entries of the journal at path, creating it if needed, and opens it for appending new entries.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening journal %s: %w", path, err)
+	}
+
+	j := &Journal{
+		file:  file,
+		saved: make(map[string]JournalEntry),
+	}
+	if err := j.loadFile(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed loading journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+// ReadJournal loads the entries of the journal at path, if it exists, without creating nor changing it,
+// for the runs which only need to know what has been saved. Recording entries in it fails.
+func ReadJournal(path string) (*Journal, error) {
+	j := &Journal{saved: make(map[string]JournalEntry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed reading journal %s: %w", path, err)
+	}
+	if _, err := j.load(data); err != nil {
+		return nil, fmt.Errorf("failed loading journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+func (j *Journal) loadFile() error {
+	data, err := io.ReadAll(j.file)
+	if err != nil {
+		return err
+	}
+
+	complete, err := j.load(data)
+	if err != nil {
+		return err
+	}
+	if complete < len(data) {
+		//	the last line has been cut short by a killed run, drop it
+		logrus.Warnf("dropping incomplete last line of journal %s", j.file.Name())
+		return j.file.Truncate(int64(complete))
+	}
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		_, err = j.file.Write([]byte("\n"))
+	}
+	return err
+}
+
+// load adds the entries of the journal data, returning the length of its complete lines,
+// which excludes a last line cut short.
+func (j *Journal) load(data []byte) (int, error) {
+	complete := data
+	var last []byte
+	if i := bytes.LastIndexByte(data, '\n'); i < len(data)-1 {
+		complete, last = data[:i+1], data[i+1:]
+	}
+
+	for i, line := range bytes.Split(complete, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return 0, fmt.Errorf("invalid entry at line %d: %w", i+1, err)
+		}
+		j.saved[entry.Path] = entry
+	}
+
+	if len(last) == 0 {
+		return len(data), nil
+	}
+	var entry JournalEntry
+	if err := json.Unmarshal(last, &entry); err != nil {
+		return len(complete), nil
+	}
+	j.saved[entry.Path] = entry
+	return len(data), nil
+}
+
+// Record appends an entry to the journal.
+func (j *Journal) Record(entry JournalEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed encoding journal entry for %s: %w", entry.Path, err)
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return fmt.Errorf("failed writing journal entry for %s: %w", entry.Path, errJournalReadOnly)
+	}
+	if _, err := j.file.Write(line); err != nil {
+		return fmt.Errorf("failed writing journal entry for %s: %w", entry.Path, err)
+	}
+	j.saved[entry.Path] = entry
+	return nil
+}
+
+// Saved returns the journal entry of the file at the base relative path, if any.
+func (j *Journal) Saved(path string) (JournalEntry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entry, ok := j.saved[path]
+	return entry, ok
+}
+
+// Len returns the number of files recorded in the journal.
+func (j *Journal) Len() int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return len(j.saved)
+}
+
+func (j *Journal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// NewResumingFilesFinder returns a FilesFinder which skips the files found by filesFinder that are already recorded
+// in the journal under the ID given by idMapper, with the same size and SHA-256 digest.
+// A nil idMapper stands for the files saved under their base relative paths.
+func NewResumingFilesFinder(filesFinder FilesFinder, journal *Journal, basedir string, idMapper IDMapper) FilesFinder {
+	if idMapper == nil {
+		idMapper = pathIDMapper{}
+	}
+	return &resumingFilesFinder{
+		filesFinder: filesFinder,
+		journal:     journal,
+		basedir:     basedir,
+		idMapper:    idMapper,
+	}
+}
+
+type resumingFilesFinder struct {
+	filesFinder FilesFinder
+	journal     *Journal
+	basedir     string
+	idMapper    IDMapper
+}
+
+func (f *resumingFilesFinder) Run(ctx context.Context, filesCh chan<- string) error {
+	defer close(filesCh)
+
+	foundCh := make(chan string, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- f.filesFinder.Run(ctx, foundCh)
+	}()
+
+	skipped := 0
+	for fn := range foundCh {
+		if f.alreadySaved(fn) {
+			skipped++
+			logrus.Debugf("Skipping file %s, already saved according to the journal", fn)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			//	keep draining so that the wrapped finder can terminate
+		case filesCh <- fn:
+		}
+	}
+	logrus.Infof("Skipped %d files already saved according to the journal", skipped)
+	return <-errCh
+}
+
+func (f *resumingFilesFinder) alreadySaved(fileName string) bool {
+	entry, ok := f.journal.Saved(fileName)
+	if !ok {
+		return false
+	}
+	//	saved under another ID, e.g. before changing the id options
+	if id, err := f.idMapper.ID(fileName); err != nil || id != entry.ID {
+		return false
+	}
+	path := filepath.Join(f.basedir, fileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		//	let the worker report the error
+		return false
+	}
+	if info.Size() != entry.Size {
+		return false
+	}
+	//	a file rewritten in place may keep its size
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return false
+	}
+	return sum == entry.SHA256
+}
+
+// fileSHA256 returns the hex encoded SHA-256 digest of the file at path.
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
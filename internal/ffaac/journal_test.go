@@ -0,0 +1,158 @@
+package ffaac_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api/pkg/pb/bfaa"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestJournalRecordAndReload(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	journal, err := ffaac.OpenJournal(journalPath)
+	require.NoError(t, err)
+	require.NoError(t, journal.Record(ffaac.JournalEntry{ID: "one.pdf", Path: "one.pdf", Size: 7, SHA256: "abc"}))
+	require.NoError(t, journal.Close())
+
+	// simulate a run killed while writing an entry
+	f, err := os.OpenFile(journalPath, os.O_APPEND|os.O_WRONLY, 0666)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"id":"two.pdf","pa`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	journal, err = ffaac.OpenJournal(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, journal.Len())
+	require.NoError(t, journal.Record(ffaac.JournalEntry{ID: "three.pdf", Path: "three.pdf", Size: 9}))
+	require.NoError(t, journal.Close())
+
+	journal, err = ffaac.OpenJournal(journalPath)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	assert.Equal(t, 2, journal.Len())
+	entry, ok := journal.Saved("one.pdf")
+	require.True(t, ok)
+	assert.Equal(t, ffaac.JournalEntry{ID: "one.pdf", Path: "one.pdf", Size: 7, SHA256: "abc"}, entry)
+	_, ok = journal.Saved("two.pdf")
+	assert.False(t, ok)
+	_, ok = journal.Saved("three.pdf")
+	assert.True(t, ok)
+}
+
+func TestProcessResumeFromJournal(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", "two.pdf", filepath.Join("fold1", "three.pdf")}
+	ti.createTestFiles(t, fileNames...)
+
+	journal, err := ffaac.OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	require.NoError(t, err)
+	defer journal.Close()
+
+	// first run saves everything and records it
+	for _, fileName := range fileNames {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"}), ffaac.WithJournal(journal))
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+	assert.Equal(t, 3, journal.Len())
+
+	entry, ok := journal.Saved("one.pdf")
+	require.True(t, ok)
+	assert.Equal(t, "one.pdf", entry.ID)
+	assert.Equal(t, int64(len("one.pdf")), entry.Size)
+	sum := sha256.Sum256([]byte("one.pdf"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), entry.SHA256)
+
+	// the resumed run only saves new files and the changed ones, in size or just in content
+	ti.createTestFiles(t, "four.pdf")
+	require.NoError(t, os.WriteFile(filepath.Join(ti.basedir, "two.pdf"), []byte("two.pdf changed"), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(ti.basedir, "one.pdf"), []byte("ONE.PDF"), 0666))
+
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest("four.pdf")).Return(nil, nil).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.SaveBillFulfilmentArchiveRequest{
+		Id:      "one.pdf",
+		Archive: &bfaa.BillFulfilmentArchive{Data: []byte("ONE.PDF")},
+	})).Return(nil, nil).Times(1)
+	ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.SaveBillFulfilmentArchiveRequest{
+		Id:      "two.pdf",
+		Archive: &bfaa.BillFulfilmentArchive{Data: []byte("two.pdf changed")},
+	})).Return(nil, nil).Times(1)
+
+	filesFinder := ffaac.NewResumingFilesFinder(ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"}), journal, ti.basedir, nil)
+	processor = ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithJournal(journal))
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+	assert.Equal(t, 4, journal.Len())
+}
+
+func TestProcessResumeWithChangedIDs(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true, "pdf")
+	defer ti.finish()
+	ti.createTestFiles(t, "one.pdf", "two.pdf")
+
+	journal, err := ffaac.OpenJournal(filepath.Join(t.TempDir(), "journal.jsonl"))
+	require.NoError(t, err)
+	defer journal.Close()
+	for _, fileName := range []string{"one.pdf", "two.pdf"} {
+		sum := sha256.Sum256([]byte(fileName))
+		require.NoError(t, journal.Record(ffaac.JournalEntry{ID: "bills/" + fileName, Path: fileName, Size: int64(len(fileName)), SHA256: hex.EncodeToString(sum[:])}))
+	}
+
+	//	saved with --id-prefix bills/, resumed with bills/2023/
+	idMapper, err := ffaac.NewTemplateIDMapper("{path}", "", "bills/2023/", "")
+	require.NoError(t, err)
+	for _, fileName := range []string{"one.pdf", "two.pdf"} {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), ProtoMatcher(&bfaa.SaveBillFulfilmentArchiveRequest{
+			Id:      "bills/2023/" + fileName,
+			Archive: &bfaa.BillFulfilmentArchive{Data: []byte(fileName)},
+		})).Return(nil, nil).Times(1)
+	}
+
+	filesFinder := ffaac.NewResumingFilesFinder(ffaac.NewFilesFinder(ti.basedir, true, []string{"pdf"}), journal, ti.basedir, idMapper)
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder, ffaac.WithIDMapper(idMapper), ffaac.WithJournal(journal))
+	require.NoError(t, processor.ProcessFiles(context.Background()))
+
+	entry, ok := journal.Saved("one.pdf")
+	require.True(t, ok)
+	assert.Equal(t, "bills/2023/one.pdf", entry.ID)
+}
+
+func TestReadJournal(t *testing.T) {
+	journalPath := filepath.Join(t.TempDir(), "journal.jsonl")
+
+	//	missing, and not created
+	journal, err := ffaac.ReadJournal(journalPath)
+	require.NoError(t, err)
+	assert.Zero(t, journal.Len())
+	assert.Error(t, journal.Record(ffaac.JournalEntry{ID: "one.pdf", Path: "one.pdf"}))
+	require.NoError(t, journal.Close())
+	_, err = os.Stat(journalPath)
+	assert.True(t, os.IsNotExist(err))
+
+	content := `{"id":"one.pdf","path":"one.pdf","size":7}` + "\n" + `{"id":"two.pdf","pa`
+	require.NoError(t, os.WriteFile(journalPath, []byte(content), 0666))
+	journal, err = ffaac.ReadJournal(journalPath)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	assert.Equal(t, 1, journal.Len())
+	_, ok := journal.Saved("one.pdf")
+	assert.True(t, ok)
+	//	left as it is
+	data, err := os.ReadFile(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
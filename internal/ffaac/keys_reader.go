@@ -0,0 +1,111 @@
+package ffaac
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// KeysReader sends the keys (IDs, account numbers, ...) to process on keysCh, closing it when done.
+type KeysReader func(ctx context.Context, keysCh chan<- string) error
+
+// KeysFromList returns a keys reader which sends the given keys.
+func KeysFromList(keys ...string) KeysReader {
+	return func(ctx context.Context, keysCh chan<- string) error {
+		defer close(keysCh)
+		for _, key := range keys {
+			select {
+			case <-ctx.Done():
+				return nil
+			case keysCh <- key:
+			}
+		}
+		return nil
+	}
+}
+
+// KeysFromReader returns a keys reader which sends every non-empty line read from r, skipping duplicates
+// and lines starting with #.
+func KeysFromReader(r io.Reader) KeysReader {
+	return func(ctx context.Context, keysCh chan<- string) error {
+		defer close(keysCh)
+
+		seen := make(map[string]bool)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			key := strings.TrimSpace(scanner.Text())
+			if key == "" || strings.HasPrefix(key, "#") || seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case keysCh <- key:
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("failed reading keys: %w", err)
+		}
+		return nil
+	}
+}
+
+// readAllKeys returns all the keys sent by keysReader, failing if ctx is done before the end.
+func readAllKeys(ctx context.Context, keysReader KeysReader) ([]string, error) {
+	keysCh := make(chan string, 100)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- keysReader(ctx, keysCh)
+	}()
+
+	var keys []string
+	for key := range keysCh {
+		keys = append(keys, key)
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	return keys, ctx.Err()
+}
+
+// processKeys calls process for every key sent by keysReader, using the given number of workers.
+// It stops at the first error, or when parentCtx is done, returning its error so that an interrupted run is not
+// taken for a complete one.
+func processKeys(parentCtx context.Context, keysReader KeysReader, workers int, process func(ctx context.Context, key string) error) error {
+	keysCh := make(chan string, 100)
+
+	wg, ctx := errgroup.WithContext(parentCtx)
+
+	wg.Go(func() error {
+		return keysReader(ctx, keysCh)
+	})
+
+	for i := 0; i < workers; i++ {
+		wg.Go(func() error {
+			for {
+				select {
+				case <-ctx.Done():
+					return nil
+				case key, ok := <-keysCh:
+					if !ok {
+						return nil
+					}
+					if err := process(ctx, key); err != nil {
+						return err
+					}
+				}
+			}
+		})
+	}
+
+	if err := wg.Wait(); err != nil {
+		return err
+	}
+	return parentCtx.Err()
+}
@@ -0,0 +1,93 @@
+package ffaac
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// NewManifestFilesFinder returns a FilesFinder which reads the paths of the files to process from r,
+// separated by newlines or, if nullSeparated is set, by NUL characters as printed by find -print0.
+// Relative paths are resolved against the current working directory, and every path must point inside basedir.
+func NewManifestFilesFinder(basedir string, r io.Reader, nullSeparated bool) FilesFinder {
+	return &manifestFilesFinder{
+		basedir:       basedir,
+		r:             r,
+		nullSeparated: nullSeparated,
+	}
+}
+
+type manifestFilesFinder struct {
+	basedir       string
+	r             io.Reader
+	nullSeparated bool
+}
+
+func (f *manifestFilesFinder) Run(ctx context.Context, filesCh chan<- string) error {
+	defer close(filesCh)
+
+	absBasedir, err := filepath.Abs(f.basedir)
+	if err != nil {
+		return fmt.Errorf("failed resolving base dir %s: %w", f.basedir, err)
+	}
+
+	scanner := bufio.NewScanner(f.r)
+	if f.nullSeparated {
+		scanner.Split(scanNullSeparated)
+	}
+
+	for scanner.Scan() {
+		path := scanner.Text()
+		if !f.nullSeparated {
+			path = strings.TrimRight(path, "\r")
+		}
+		if path == "" {
+			continue
+		}
+
+		baseRelativeName, err := baseRelativePath(absBasedir, path)
+		if err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case filesCh <- baseRelativeName:
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed reading the list of files: %w", err)
+	}
+	return nil
+}
+
+// baseRelativePath returns path relative to absBasedir, failing if it is not inside it.
+func baseRelativePath(absBasedir string, path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed resolving file %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(absBasedir, absPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file %s is not inside the base dir %s", path, absBasedir)
+	}
+	return rel, nil
+}
+
+func scanNullSeparated(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
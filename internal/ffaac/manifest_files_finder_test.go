@@ -0,0 +1,78 @@
+package ffaac_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestProcessFilesFromManifest(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true)
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", filepath.Join("fold1", "two.csv"), filepath.Join("fold1", "fold2", "three.txt")}
+	ti.createTestFiles(t, append(fileNames, "not-listed.pdf")...)
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	relToCwd, err := filepath.Rel(cwd, filepath.Join(ti.basedir, fileNames[2]))
+	require.NoError(t, err)
+
+	manifest := strings.Join([]string{
+		filepath.Join(ti.basedir, fileNames[0]),
+		"",
+		ti.basedir + "/fold1/./two.csv\r",
+		relToCwd,
+	}, "\n")
+
+	for _, fileName := range fileNames {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+
+	filesFinder := ffaac.NewManifestFilesFinder(ti.basedir, strings.NewReader(manifest), false)
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder)
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
+
+func TestProcessFilesFromNullSeparatedManifest(t *testing.T) {
+	ti := initProcessorWithRealFinder(t, true)
+	defer ti.finish()
+
+	fileNames := []string{"with\nnewline.pdf", filepath.Join("fold1", "with space.pdf")}
+	ti.createTestFiles(t, fileNames...)
+
+	manifest := filepath.Join(ti.basedir, fileNames[0]) + "\x00" + filepath.Join(ti.basedir, fileNames[1]) + "\x00"
+
+	for _, fileName := range fileNames {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+
+	filesFinder := ffaac.NewManifestFilesFinder(ti.basedir, strings.NewReader(manifest), true)
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, filesFinder)
+	assert.NoError(t, processor.ProcessFiles(context.Background()))
+}
+
+func TestManifestFilesOutsideBasedir(t *testing.T) {
+	basedir := filepath.Join(t.TempDir(), "base")
+
+	for _, path := range []string{
+		basedir,
+		filepath.Join(basedir, "..", "other.pdf"),
+		filepath.Join(basedir+"-sibling", "one.pdf"),
+		"/etc/passwd",
+	} {
+		filesFinder := ffaac.NewManifestFilesFinder(basedir, strings.NewReader(path+"\n"), false)
+		filesCh := make(chan string, 10)
+		err := filesFinder.Run(context.Background(), filesCh)
+		assert.Error(t, err, path)
+		assert.Empty(t, filesCh, path)
+	}
+}
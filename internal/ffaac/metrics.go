@@ -0,0 +1,124 @@
+package ffaac
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+const metricsNamespace = "ffaac"
+
+// Metrics counts the files processed by the FilesProcessor. Its methods are no-ops on a nil Metrics.
+type Metrics struct {
+	filesDiscovered prometheus.Counter
+	filesUploaded   prometheus.Counter
+	filesSkipped    prometheus.Counter
+	filesFailed     *prometheus.CounterVec
+	bytesSent       prometheus.Counter
+	uploadDuration  prometheus.Histogram
+	// concurrency is only registered in adaptive mode, where the concurrency changes
+	concurrency     prometheus.Gauge
+	reg             prometheus.Registerer
+	concurrencyOnce sync.Once
+}
+
+// NewMetrics creates the upload metrics and registers them with reg.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		reg: reg,
+		filesDiscovered: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "files_discovered_total",
+			Help:      "The number of files found to upload.",
+		}),
+		filesUploaded: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "files_uploaded_total",
+			Help:      "The number of files saved in the fulfilment archive.",
+		}),
+		filesSkipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "files_skipped_total",
+			Help:      "The number of files not uploaded because already archived.",
+		}),
+		filesFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "files_failed_total",
+			Help:      "The number of files which could not be saved, by failure reason.",
+		}, []string{"reason"}),
+		bytesSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bytes_sent_total",
+			Help:      "The number of bytes of the files saved in the fulfilment archive.",
+		}),
+		uploadDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upload_duration_seconds",
+			Help:      "The duration of the calls saving a file in the fulfilment archive, retries included.",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+		}),
+		concurrency: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "upload_concurrency",
+			Help:      "The number of files which can be uploaded at once, as adapted to the pressure on the fulfilment archive api.",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{m.filesDiscovered, m.filesUploaded, m.filesSkipped, m.filesFailed, m.bytesSent, m.uploadDuration} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Metrics) fileDiscovered() {
+	if m != nil {
+		m.filesDiscovered.Inc()
+	}
+}
+
+func (m *Metrics) fileSkipped() {
+	if m != nil {
+		m.filesSkipped.Inc()
+	}
+}
+
+func (m *Metrics) fileFailed(reason string) {
+	if m != nil {
+		m.filesFailed.WithLabelValues(reason).Inc()
+	}
+}
+
+func (m *Metrics) uploadCalled(duration time.Duration) {
+	if m != nil {
+		m.uploadDuration.Observe(duration.Seconds())
+	}
+}
+
+func (m *Metrics) fileUploaded(size int) {
+	if m != nil {
+		m.filesUploaded.Inc()
+		m.bytesSent.Add(float64(size))
+	}
+}
+
+// adaptiveConcurrency registers the concurrency gauge, the first time an adaptive upload starts.
+func (m *Metrics) adaptiveConcurrency() {
+	if m == nil {
+		return
+	}
+	m.concurrencyOnce.Do(func() {
+		if err := m.reg.Register(m.concurrency); err != nil {
+			logrus.WithError(err).Warn("failed registering the upload concurrency metric")
+		}
+	})
+}
+
+func (m *Metrics) concurrencyChanged(limit int) {
+	if m != nil {
+		m.concurrency.Set(float64(limit))
+	}
+}
@@ -0,0 +1,70 @@
+package ffaac_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/ffaac"
+)
+
+func TestProcessMetrics(t *testing.T) {
+	ti := initProcessorWithMockFinder(t)
+	defer ti.finish()
+
+	fileNames := []string{"one.pdf", "three.pdf"}
+	ti.createTestFiles(t, fileNames...)
+
+	reg := prometheus.NewRegistry()
+	metrics, err := ffaac.NewMetrics(reg)
+	require.NoError(t, err)
+
+	processor := ffaac.NewFileProcessor(ti.mockArchiveAPIClient, ti.basedir, workers, ti.mockFilesFinder,
+		ffaac.WithContinueOnError(), ffaac.WithMetrics(metrics))
+
+	ti.mockFilesFinder.EXPECT().Run(gomock.Any(), gomock.Any()).Times(1).DoAndReturn(
+		func(ctx context.Context, filesCh chan<- string) error {
+			for _, fileName := range append(fileNames, "missing.pdf") {
+				filesCh <- fileName
+			}
+			close(filesCh)
+			return nil
+		})
+	for _, fileName := range fileNames {
+		ti.mockArchiveAPIClient.EXPECT().SaveBillFulfilmentArchive(gomock.Any(), getExpectedSaveRequest(fileName)).Return(nil, nil).Times(1)
+	}
+
+	assert.True(t, errors.Is(processor.ProcessFiles(context.Background()), ffaac.ErrFilesFailed))
+
+	expected := `
+# HELP ffaac_bytes_sent_total The number of bytes of the files saved in the fulfilment archive.
+# TYPE ffaac_bytes_sent_total counter
+ffaac_bytes_sent_total 16
+# HELP ffaac_files_discovered_total The number of files found to upload.
+# TYPE ffaac_files_discovered_total counter
+ffaac_files_discovered_total 3
+# HELP ffaac_files_failed_total The number of files which could not be saved, by failure reason.
+# TYPE ffaac_files_failed_total counter
+ffaac_files_failed_total{reason="read"} 1
+# HELP ffaac_files_uploaded_total The number of files saved in the fulfilment archive.
+# TYPE ffaac_files_uploaded_total counter
+ffaac_files_uploaded_total 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"ffaac_bytes_sent_total", "ffaac_files_discovered_total", "ffaac_files_failed_total", "ffaac_files_uploaded_total"))
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == "ffaac_upload_duration_seconds" {
+			assert.Equal(t, uint64(2), family.GetMetric()[0].GetHistogram().GetSampleCount())
+		}
+	}
+}
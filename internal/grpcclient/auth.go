@@ -0,0 +1,118 @@
+package grpcclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// BearerToken returns the credentials sending token as bearer token in the authorization metadata of every call.
+// Unless allowInsecure, the calls fail when the connection does not use TLS, rather than leaking the token.
+func BearerToken(token string, allowInsecure bool) (credentials.PerRPCCredentials, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, errors.New("the bearer token is empty")
+	}
+	return &bearerToken{token: token, allowInsecure: allowInsecure}, nil
+}
+
+// BearerTokenFile returns the credentials sending the content of the file as bearer token, as BearerToken does.
+// The file is read again whenever it changes, so that the token can be renewed while a command runs.
+func BearerTokenFile(path string, allowInsecure bool) (credentials.PerRPCCredentials, error) {
+	t := &bearerToken{file: path, allowInsecure: allowInsecure}
+	if _, err := t.currentToken(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+type bearerToken struct {
+	allowInsecure bool
+	file          string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+func (t *bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	token, err := t.currentToken()
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return map[string]string{"authorization": "Bearer " + token}, nil
+}
+
+func (t *bearerToken) RequireTransportSecurity() bool {
+	return !t.allowInsecure
+}
+
+func (t *bearerToken) currentToken() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.file == "" {
+		return t.token, nil
+	}
+
+	modTime, err := lastModified(t.file)
+	if err != nil {
+		return "", err
+	}
+	if t.token != "" && modTime.Equal(t.modTime) {
+		return t.token, nil
+	}
+
+	data, err := os.ReadFile(t.file)
+	if err != nil {
+		return "", fmt.Errorf("failed reading the bearer token %s: %w", t.file, err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("the bearer token file %s is empty", t.file)
+	}
+	t.token, t.modTime = token, modTime
+	return token, nil
+}
+
+// StaticHeaders returns the credentials sending the given metadata with every call.
+func StaticHeaders(headers map[string]string) credentials.PerRPCCredentials {
+	return staticHeaders(headers)
+}
+
+type staticHeaders map[string]string
+
+func (h staticHeaders) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return h, nil
+}
+
+func (h staticHeaders) RequireTransportSecurity() bool {
+	return false
+}
+
+// ParseHeaders parses headers in the key=value form into metadata, with the keys in lower case as gRPC requires.
+func ParseHeaders(headers []string) (map[string]string, error) {
+	parsed := make(map[string]string, len(headers))
+	for _, header := range headers {
+		key, value, ok := strings.Cut(header, "=")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid header %q, expected key=value", header)
+		}
+		if strings.HasPrefix(key, "grpc-") || strings.IndexFunc(key, func(r rune) bool {
+			return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+		}) >= 0 {
+			return nil, fmt.Errorf("invalid header name %q", key)
+		}
+		parsed[key] = value
+	}
+	return parsed, nil
+}
@@ -0,0 +1,108 @@
+package grpcclient_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+func checkWithCredentials(t *testing.T, server *fakeServer, creds ...credentials.PerRPCCredentials) error {
+	lis := startFakeServer(t, server)
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	for _, c := range creds {
+		opts = append(opts, grpc.WithPerRPCCredentials(c))
+	}
+	_, err := dialListener(t, lis, nil, opts...).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	return err
+}
+
+func TestBearerToken(t *testing.T) {
+	token, err := grpcclient.BearerToken(" secret\n", true)
+	require.NoError(t, err)
+
+	server := &fakeServer{}
+	require.NoError(t, checkWithCredentials(t, server, token))
+	assert.Equal(t, []string{"Bearer secret"}, server.lastMetadata().Get("authorization"))
+
+	_, err = grpcclient.BearerToken(" ", true)
+	assert.Error(t, err)
+}
+
+func TestBearerTokenRequiresTLS(t *testing.T) {
+	token, err := grpcclient.BearerToken("secret", false)
+	require.NoError(t, err)
+
+	_, err = grpcclient.Dial(context.Background(), "bufnet", nil,
+		grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithPerRPCCredentials(token))
+	assert.Error(t, err)
+}
+
+func TestBearerTokenOverTLS(t *testing.T) {
+	ca := newTestCA(t)
+	server := &fakeServer{}
+	lis := startTLSServer(t, ca, nil, server)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, ca.pem)
+	creds, err := grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: caFile, ServerName: testServerName})
+	require.NoError(t, err)
+	token, err := grpcclient.BearerToken("secret", false)
+	require.NoError(t, err)
+
+	client := dialListener(t, lis, nil, grpc.WithTransportCredentials(creds), grpc.WithPerRPCCredentials(token))
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer secret"}, server.lastMetadata().Get("authorization"))
+}
+
+func TestBearerTokenFile(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenFile, []byte("first\n"))
+
+	token, err := grpcclient.BearerTokenFile(tokenFile, true)
+	require.NoError(t, err)
+
+	server := &fakeServer{}
+	lis := startFakeServer(t, server)
+	client := dialListener(t, lis, nil, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithPerRPCCredentials(token))
+
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer first"}, server.lastMetadata().Get("authorization"))
+
+	//	the token is renewed while the connection is open
+	writeFile(t, tokenFile, []byte("second\n"))
+	_, err = client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer second"}, server.lastMetadata().Get("authorization"))
+
+	_, err = grpcclient.BearerTokenFile(filepath.Join(t.TempDir(), "missing"), true)
+	assert.Error(t, err)
+}
+
+func TestStaticHeaders(t *testing.T) {
+	headers, err := grpcclient.ParseHeaders([]string{"X-Tenant=billing", "x-request-source=backfill=2023"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"x-tenant": "billing", "x-request-source": "backfill=2023"}, headers)
+
+	server := &fakeServer{}
+	require.NoError(t, checkWithCredentials(t, server, grpcclient.StaticHeaders(headers)))
+	assert.Equal(t, []string{"billing"}, server.lastMetadata().Get("x-tenant"))
+	assert.Equal(t, []string{"backfill=2023"}, server.lastMetadata().Get("x-request-source"))
+}
+
+func TestParseHeadersErrors(t *testing.T) {
+	for _, header := range []string{"no-value", "=value", "grpc-timeout=1s", "bad key=value"} {
+		_, err := grpcclient.ParseHeaders([]string{header})
+		assert.Error(t, err, header)
+	}
+}
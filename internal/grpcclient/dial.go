@@ -0,0 +1,66 @@
+// Package grpcclient opens the gRPC connections to the fulfilment archive api, with a chain of client interceptors.
+package grpcclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Dial connects to address, running every unary call through the interceptors in order, the first one being the outermost.
+// The opts are applied after the defaults, so that they can override them, and must include the transport credentials.
+func Dial(ctx context.Context, address string, interceptors []grpc.UnaryClientInterceptor, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+	dialOpts := []grpc.DialOption{
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(math.MaxInt32),
+			grpc.MaxCallSendMsgSize(math.MaxInt32),
+		),
+		//	a single chain, as every grpc.WithUnaryInterceptor replaces the previous one
+		grpc.WithChainUnaryInterceptor(interceptors...),
+	}
+
+	conn, err := grpc.DialContext(ctx, address, append(dialOpts, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed dialing %s: %w", address, err)
+	}
+	return conn, nil
+}
+
+// MetricsInterceptor records the grpc_client_* Prometheus metrics of every call in the default registry.
+func MetricsInterceptor() grpc.UnaryClientInterceptor {
+	return grpc_prometheus.UnaryClientInterceptor
+}
+
+type logFieldsKey struct{}
+
+// ContextWithLogFields returns a context whose calls are logged by the interceptors with fields, e.g. the file a call
+// is made for, so that the logs of the many calls made at once can be told apart.
+func ContextWithLogFields(ctx context.Context, fields logrus.Fields) context.Context {
+	return context.WithValue(ctx, logFieldsKey{}, fields)
+}
+
+// logEntry returns an entry with the log fields of ctx, if any.
+func logEntry(ctx context.Context) *logrus.Entry {
+	fields, _ := ctx.Value(logFieldsKey{}).(logrus.Fields)
+	return logrus.WithFields(fields)
+}
+
+// LoggingInterceptor logs every call at debug level, with its outcome and duration.
+func LoggingInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		logEntry(ctx).WithFields(logrus.Fields{
+			"grpc_method": method,
+			"grpc_code":   status.Code(err).String(),
+			"duration_ms": time.Since(start).Milliseconds(),
+		}).Debug("gRPC call ended")
+		return err
+	}
+}
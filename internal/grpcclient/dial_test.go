@@ -0,0 +1,170 @@
+package grpcclient_test
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+const checkMethod = "/grpc.health.v1.Health/Check"
+
+// fakeServer fails its first calls with the status codes of faults, one per call, then succeeds.
+// Every call takes at least delay, unless cancelled.
+type fakeServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+	faults []codes.Code
+	delay  time.Duration
+	calls  int32
+
+	mu sync.Mutex
+	md metadata.MD
+}
+
+func (s *fakeServer) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	s.mu.Lock()
+	s.md, _ = metadata.FromIncomingContext(ctx)
+	s.mu.Unlock()
+
+	call := int(atomic.AddInt32(&s.calls, 1))
+	select {
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case <-time.After(s.delay):
+	}
+
+	if call <= len(s.faults) {
+		return nil, status.Error(s.faults[call-1], "injected fault")
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+// dialFakeServer starts an in-process server and dials it through grpcclient.Dial.
+func dialFakeServer(t *testing.T, server *fakeServer, interceptors ...grpc.UnaryClientInterceptor) grpc_health_v1.HealthClient {
+	lis := startFakeServer(t, server)
+	return dialListener(t, lis, interceptors, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
+
+// lastMetadata returns the metadata received with the last call.
+func (s *fakeServer) lastMetadata() metadata.MD {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.md
+}
+
+func startFakeServer(t *testing.T, server *fakeServer, opts ...grpc.ServerOption) *bufconn.Listener {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(opts...)
+	grpc_health_v1.RegisterHealthServer(s, server)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+	return lis
+}
+
+func dialListener(t *testing.T, lis *bufconn.Listener, interceptors []grpc.UnaryClientInterceptor, opts ...grpc.DialOption) grpc_health_v1.HealthClient {
+	return dialListenerAs(t, lis, "bufnet", interceptors, opts...)
+}
+
+// dialListenerAs connects to lis as if it was listening at target.
+func dialListenerAs(t *testing.T, lis *bufconn.Listener, target string, interceptors []grpc.UnaryClientInterceptor, opts ...grpc.DialOption) grpc_health_v1.HealthClient {
+	opts = append(opts, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	conn, err := grpcclient.Dial(context.Background(), target, interceptors, opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+// recorder returns interceptors appending their name to the calls recorded.
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) interceptor(name string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		r.mu.Lock()
+		r.calls = append(r.calls, name)
+		r.mu.Unlock()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+func TestDialRunsAllInterceptorsInOrder(t *testing.T) {
+	r := &recorder{}
+	client := dialFakeServer(t, &fakeServer{}, r.interceptor("first"), r.interceptor("second"), r.interceptor("third"))
+
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second", "third"}, r.calls)
+}
+
+func TestMetricsInterceptor(t *testing.T) {
+	client := dialFakeServer(t, &fakeServer{faults: []codes.Code{codes.Unavailable}}, grpcclient.MetricsInterceptor())
+
+	before := handledCalls(t, codes.Unavailable)
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, before+1, handledCalls(t, codes.Unavailable))
+}
+
+// handledCalls returns the grpc_client_handled_total of the health check calls with code.
+func handledCalls(t *testing.T, code codes.Code) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "grpc_client_handled_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["grpc_service"] == "grpc.health.v1.Health" && labels["grpc_method"] == "Check" && labels["grpc_code"] == code.String() {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+	return 0
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+	hook := logrustest.NewGlobal()
+	defer hook.Reset()
+	level := logrus.GetLevel()
+	defer logrus.SetLevel(level)
+	logrus.SetLevel(logrus.DebugLevel)
+
+	client := dialFakeServer(t, &fakeServer{}, grpcclient.LoggingInterceptor())
+
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	entry := hook.LastEntry()
+	require.NotNil(t, entry)
+	assert.Equal(t, checkMethod, entry.Data["grpc_method"])
+	assert.Equal(t, "OK", entry.Data["grpc_code"])
+}
@@ -0,0 +1,96 @@
+package grpcclient
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// RateLimiter caps the calls per second made to the server, and the bytes per second sent to it,
+// across all the calls sharing it. Its methods never wait on a nil RateLimiter.
+type RateLimiter struct {
+	calls *rate.Limiter
+	bytes *rate.Limiter
+}
+
+// NewRateLimiter creates a RateLimiter allowing callsPerSec calls and bytesPerSec bytes every second,
+// either of them being unlimited when 0.
+// The calls are allowed in bursts of up to one second worth of calls, the bytes in bursts of up to one second worth of bytes.
+func NewRateLimiter(callsPerSec float64, bytesPerSec int) *RateLimiter {
+	l := &RateLimiter{}
+	if callsPerSec > 0 {
+		l.calls = rate.NewLimiter(rate.Limit(callsPerSec), int(math.Max(1, math.Ceil(callsPerSec))))
+	}
+	if bytesPerSec > 0 {
+		l.bytes = rate.NewLimiter(rate.Limit(bytesPerSec), bytesPerSec)
+	}
+	return l
+}
+
+// RateLimitInterceptor makes every call wait for limiter, counting its request size against the bytes limit.
+// Placed after the RetryInterceptor, every attempt waits, so that the retries count against the limits too.
+// The wait does not count against the CallTimeoutInterceptor deadline when placed before it. A nil limiter disables it.
+func RateLimitInterceptor(limiter *RateLimiter) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := limiter.waitCall(ctx); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		if msg, ok := req.(proto.Message); ok {
+			if err := limiter.waitBytes(ctx, proto.Size(msg)); err != nil {
+				return status.FromContextError(err).Err()
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// waitCall waits until a call can be made, or ctx is done.
+func (l *RateLimiter) waitCall(ctx context.Context) error {
+	if l == nil || l.calls == nil {
+		return nil
+	}
+	return wait(ctx, l.calls, 1)
+}
+
+// waitBytes waits until n bytes can be sent, or ctx is done.
+func (l *RateLimiter) waitBytes(ctx context.Context, n int) error {
+	if l == nil || l.bytes == nil {
+		return nil
+	}
+	//	requests larger than the burst are let through one burst at a time
+	for burst := l.bytes.Burst(); n > 0; n -= burst {
+		chunk := n
+		if chunk > burst {
+			chunk = burst
+		}
+		if err := wait(ctx, l.bytes, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// wait is rate.Limiter.WaitN, except that it waits for ctx to be done rather than failing straight away
+// when the wait would go past the ctx deadline, so that it always returns the ctx error.
+func wait(ctx context.Context, limiter *rate.Limiter, n int) error {
+	r := limiter.ReserveN(time.Now(), n)
+	delay := r.Delay()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,82 @@
+package grpcclient_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+func TestRateLimitInterceptorLimitsCalls(t *testing.T) {
+	client := dialFakeServer(t, &fakeServer{}, grpcclient.RateLimitInterceptor(grpcclient.NewRateLimiter(50, 0)))
+
+	//	the first 50 calls are let through at once, the other 10 at 50 per second
+	start := time.Now()
+	for i := 0; i < 60; i++ {
+		_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+}
+
+func TestRateLimitInterceptorLimitsBytes(t *testing.T) {
+	client := dialFakeServer(t, &fakeServer{}, grpcclient.RateLimitInterceptor(grpcclient.NewRateLimiter(0, 1000)))
+
+	//	larger than the burst of one second of bytes
+	start := time.Now()
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: strings.Repeat("a", 1500)})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestRateLimitInterceptorLimitsRetries(t *testing.T) {
+	faults := make([]codes.Code, 29)
+	for i := range faults {
+		faults[i] = codes.Unavailable
+	}
+	server := &fakeServer{faults: faults}
+	policy := testRetryPolicy()
+	policy.MaxAttempts = 30
+	policy.InitialBackoff, policy.MaxBackoff = 0, 0
+	client := dialFakeServer(t, server, grpcclient.RetryInterceptor(policy), grpcclient.RateLimitInterceptor(grpcclient.NewRateLimiter(20, 0)))
+
+	//	a single call, whose first 20 attempts are let through at once, the other 10 at 20 per second
+	start := time.Now()
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(30), atomic.LoadInt32(&server.calls))
+	assert.GreaterOrEqual(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestRateLimitInterceptorTimeout(t *testing.T) {
+	server := &fakeServer{}
+	client := dialFakeServer(t, server, grpcclient.RateLimitInterceptor(grpcclient.NewRateLimiter(0, 1000)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: strings.Repeat("a", 5000)})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&server.calls))
+}
+
+func TestRateLimitInterceptorDisabled(t *testing.T) {
+	client := dialFakeServer(t, &fakeServer{}, grpcclient.RateLimitInterceptor(nil))
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+	}
+	assert.Less(t, time.Since(start), time.Second)
+}
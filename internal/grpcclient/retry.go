@@ -0,0 +1,125 @@
+package grpcclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy configures how the failed calls are retried, with an exponential backoff between the attempts.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of a call, the first one included. 1 disables the retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled at every following one up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter is the fraction of every backoff randomly added to or removed from it, between 0 and 1.
+	Jitter float64
+	// MaxElapsedTime stops the retries once the call, backoffs included, would take longer. 0 means no limit.
+	MaxElapsedTime time.Duration
+	// RetryableCodes are the status codes of the failures which are retried.
+	RetryableCodes []codes.Code
+}
+
+// DefaultRetryPolicy returns the policy used unless configured otherwise.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Jitter:         0.2,
+		RetryableCodes: []codes.Code{codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable},
+	}
+}
+
+// Validate checks that the policy makes sense.
+func (p RetryPolicy) Validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return fmt.Errorf("the max attempts must be at least 1, got %d", p.MaxAttempts)
+	case p.InitialBackoff < 0 || p.MaxBackoff < 0 || p.MaxElapsedTime < 0:
+		return fmt.Errorf("the backoffs and the max elapsed time cannot be negative")
+	case p.Jitter < 0 || p.Jitter > 1:
+		return fmt.Errorf("the jitter must be between 0 and 1, got %v", p.Jitter)
+	}
+	return nil
+}
+
+// Backoff returns the wait before the given retry, the first one being 1.
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(2, float64(retry-1))
+	if maxBackoff := float64(p.MaxBackoff); backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	backoff *= 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(backoff)
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	code := status.Code(err)
+	for _, retryableCode := range p.RetryableCodes {
+		if code == retryableCode {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryInterceptor retries the failed calls as configured by policy. The interceptors after it run once per attempt.
+// The retries are logged with the fields given by ContextWithLogFields.
+func RetryInterceptor(policy RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		for attempt := 1; ; attempt++ {
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err == nil || ctx.Err() != nil || attempt >= policy.MaxAttempts || !policy.retryable(err) {
+				return err
+			}
+
+			backoff := policy.Backoff(attempt)
+			if policy.MaxElapsedTime > 0 && time.Since(start)+backoff > policy.MaxElapsedTime {
+				logEntry(ctx).WithError(err).Warnf("Not retrying %s after attempt %d, max elapsed time %v reached", method, attempt, policy.MaxElapsedTime)
+				return err
+			}
+			logEntry(ctx).WithError(err).Warnf("Attempt %d of %s failed, retrying in %v", attempt, method, backoff.Round(time.Millisecond))
+
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return status.FromContextError(ctx.Err()).Err()
+			case <-timer.C:
+			}
+		}
+	}
+}
+
+// ParseCodes parses status code names, either as in codes.Code.String, e.g. DeadlineExceeded, or as in the gRPC specs,
+// e.g. DEADLINE_EXCEEDED.
+func ParseCodes(names []string) ([]codes.Code, error) {
+	byName := make(map[string]codes.Code)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		byName[normaliseCodeName(c.String())] = c
+	}
+
+	parsed := make([]codes.Code, 0, len(names))
+	for _, name := range names {
+		c, ok := byName[normaliseCodeName(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown status code %q", name)
+		}
+		parsed = append(parsed, c)
+	}
+	return parsed, nil
+}
+
+func normaliseCodeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "_", ""))
+}
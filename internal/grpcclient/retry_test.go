@@ -0,0 +1,145 @@
+package grpcclient_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+func testRetryPolicy() grpcclient.RetryPolicy {
+	policy := grpcclient.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 4 * time.Millisecond
+	return policy
+}
+
+func TestRetryInterceptorRetriesUntilSuccess(t *testing.T) {
+	r := &recorder{}
+	server := &fakeServer{faults: []codes.Code{codes.Unavailable, codes.Internal}}
+	client := dialFakeServer(t, server, r.interceptor("call"), grpcclient.RetryInterceptor(testRetryPolicy()), r.interceptor("attempt"))
+
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&server.calls))
+	assert.Equal(t, []string{"call", "attempt", "attempt", "attempt"}, r.calls)
+}
+
+func TestRetryInterceptorLogsContextFields(t *testing.T) {
+	hook := logrustest.NewGlobal()
+	defer hook.Reset()
+	server := &fakeServer{faults: []codes.Code{codes.Unavailable}}
+	client := dialFakeServer(t, server, grpcclient.RetryInterceptor(testRetryPolicy()))
+
+	ctx := grpcclient.ContextWithLogFields(context.Background(), logrus.Fields{"file": "2023/bill-1.pdf"})
+	_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+
+	var retries []*logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == logrus.WarnLevel {
+			retries = append(retries, entry)
+		}
+	}
+	require.Len(t, retries, 1)
+	assert.Equal(t, "2023/bill-1.pdf", retries[0].Data["file"])
+}
+
+func TestRetryInterceptorStopsAtMaxAttempts(t *testing.T) {
+	server := &fakeServer{faults: []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable, codes.Unavailable}}
+	policy := testRetryPolicy()
+	policy.MaxAttempts = 2
+	client := dialFakeServer(t, server, grpcclient.RetryInterceptor(policy))
+
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.calls))
+}
+
+func TestRetryInterceptorOnlyRetriesRetryableCodes(t *testing.T) {
+	server := &fakeServer{faults: []codes.Code{codes.Unavailable, codes.InvalidArgument}}
+	policy := testRetryPolicy()
+	policy.RetryableCodes = []codes.Code{codes.Unavailable}
+	client := dialFakeServer(t, server, grpcclient.RetryInterceptor(policy))
+
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.calls))
+}
+
+func TestRetryInterceptorStopsAtMaxElapsedTime(t *testing.T) {
+	server := &fakeServer{faults: []codes.Code{codes.Unavailable, codes.Unavailable, codes.Unavailable}}
+	policy := testRetryPolicy()
+	policy.MaxAttempts = 10
+	policy.InitialBackoff = 50 * time.Millisecond
+	policy.MaxBackoff = time.Second
+	policy.Jitter = 0
+	policy.MaxElapsedTime = 120 * time.Millisecond
+	client := dialFakeServer(t, server, grpcclient.RetryInterceptor(policy))
+
+	//	waits 50ms then 100ms, which would go past the max elapsed time
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.calls))
+}
+
+func TestRetryInterceptorStopsWhenCancelled(t *testing.T) {
+	server := &fakeServer{faults: []codes.Code{codes.Unavailable, codes.Unavailable}}
+	policy := testRetryPolicy()
+	policy.InitialBackoff = time.Minute
+	policy.MaxBackoff = time.Minute
+	client := dialFakeServer(t, server, grpcclient.RetryInterceptor(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.calls))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := grpcclient.RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: 0.2}
+	for retry, expected := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		backoff := policy.Backoff(retry)
+		assert.GreaterOrEqual(t, backoff, expected*8/10, "retry %d", retry)
+		assert.LessOrEqual(t, backoff, expected*12/10, "retry %d", retry)
+	}
+}
+
+func TestParseCodes(t *testing.T) {
+	parsed, err := grpcclient.ParseCodes([]string{"Unavailable", "DEADLINE_EXCEEDED", " resourceexhausted "})
+	require.NoError(t, err)
+	assert.Equal(t, []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted}, parsed)
+
+	_, err = grpcclient.ParseCodes([]string{"Unavailable", "Sometimes"})
+	assert.Error(t, err)
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	assert.NoError(t, grpcclient.DefaultRetryPolicy().Validate())
+
+	policy := grpcclient.DefaultRetryPolicy()
+	policy.MaxAttempts = 0
+	assert.Error(t, policy.Validate())
+
+	policy = grpcclient.DefaultRetryPolicy()
+	policy.Jitter = 1.5
+	assert.Error(t, policy.Validate())
+}
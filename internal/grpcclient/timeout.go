@@ -0,0 +1,31 @@
+package grpcclient
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// CallTimeoutInterceptor gives every call a deadline of timeout, plus perMiB for every MiB of its request,
+// so that large requests get more time. Placed after the RetryInterceptor, it applies to every attempt.
+// A zero timeout disables it.
+func CallTimeoutInterceptor(timeout time.Duration, perMiB time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if timeout <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, cancel := context.WithTimeout(ctx, CallTimeout(req, timeout, perMiB))
+		defer cancel()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// CallTimeout returns the deadline given to req by CallTimeoutInterceptor.
+func CallTimeout(req interface{}, timeout time.Duration, perMiB time.Duration) time.Duration {
+	if msg, ok := req.(proto.Message); ok && perMiB > 0 {
+		timeout += time.Duration(float64(perMiB) * float64(proto.Size(msg)) / (1 << 20))
+	}
+	return timeout
+}
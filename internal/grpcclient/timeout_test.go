@@ -0,0 +1,53 @@
+package grpcclient_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+func TestCallTimeoutInterceptorAppliesToEveryAttempt(t *testing.T) {
+	server := &fakeServer{delay: time.Second}
+	policy := testRetryPolicy()
+	policy.MaxAttempts = 2
+	client := dialFakeServer(t, server, grpcclient.RetryInterceptor(policy), grpcclient.CallTimeoutInterceptor(20*time.Millisecond, 0))
+
+	start := time.Now()
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&server.calls))
+	assert.Less(t, time.Since(start), server.delay)
+}
+
+func TestCallTimeoutInterceptorDisabled(t *testing.T) {
+	var hasDeadline bool
+	deadline := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		_, hasDeadline = ctx.Deadline()
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	client := dialFakeServer(t, &fakeServer{}, grpcclient.CallTimeoutInterceptor(0, time.Second), deadline)
+
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	assert.False(t, hasDeadline)
+}
+
+func TestCallTimeoutScalesWithRequestSize(t *testing.T) {
+	small := &grpc_health_v1.HealthCheckRequest{}
+	assert.Equal(t, time.Second, grpcclient.CallTimeout(small, time.Second, time.Second))
+
+	large := &grpc_health_v1.HealthCheckRequest{Service: strings.Repeat("a", 2<<20)}
+	assert.InDelta(t, 3*time.Second, grpcclient.CallTimeout(large, time.Second, time.Second), float64(time.Millisecond))
+	assert.Equal(t, time.Second, grpcclient.CallTimeout(large, time.Second, 0))
+}
@@ -0,0 +1,199 @@
+package grpcclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc/credentials"
+)
+
+// TLSConfig configures the TLS connection to the server.
+type TLSConfig struct {
+	// CACertFile is a PEM file with the CA certificates to verify the server with, instead of the system ones.
+	CACertFile string
+	// ClientCertFile and ClientKeyFile are the PEM files of the client certificate, for mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// ServerName overrides the name the server certificate is verified against, by default the host of the address.
+	ServerName string
+}
+
+// TransportCredentials returns the credentials of a TLS connection configured by cfg. The CA and client certificates
+// are read again, whenever their files change, at every new connection, so that long running commands pick up
+// the rotated certificates when reconnecting.
+func TransportCredentials(cfg TLSConfig) (credentials.TransportCredentials, error) {
+	if (cfg.ClientCertFile == "") != (cfg.ClientKeyFile == "") {
+		return nil, errors.New("the client certificate and key must be given together")
+	}
+
+	reloader := &certReloader{cfg: cfg}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: cfg.ServerName,
+	}
+
+	if cfg.ClientCertFile != "" {
+		if _, err := reloader.clientCertificate(); err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.clientCertificate()
+		}
+	}
+
+	if cfg.CACertFile != "" {
+		if _, err := reloader.caCertPool(); err != nil {
+			return nil, err
+		}
+		//	the standard verification cannot use a pool which changes, so the same checks are made in VerifyConnection
+		tlsConfig.InsecureSkipVerify = true
+		return &reloadingCredentials{TransportCredentials: credentials.NewTLS(tlsConfig), tlsConfig: tlsConfig, reloader: reloader}, nil
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// reloadingCredentials verifies the server certificate with the CA certificates read by reloader at every handshake.
+type reloadingCredentials struct {
+	credentials.TransportCredentials
+	tlsConfig *tls.Config
+	reloader  *certReloader
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	//	the name is not taken from the connection state, which has none when the address is an IP
+	serverName := c.tlsConfig.ServerName
+	if serverName == "" {
+		serverName = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			serverName = host
+		}
+	}
+	if serverName == "" {
+		return nil, nil, errors.New("no server name to verify the server certificate against")
+	}
+
+	tlsConfig := c.tlsConfig.Clone()
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		return c.reloader.verifyConnection(cs, serverName)
+	}
+	return credentials.NewTLS(tlsConfig).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	return &reloadingCredentials{TransportCredentials: c.TransportCredentials.Clone(), tlsConfig: c.tlsConfig.Clone(), reloader: c.reloader}
+}
+
+func (c *reloadingCredentials) OverrideServerName(serverName string) error {
+	c.tlsConfig.ServerName = serverName
+	return c.TransportCredentials.OverrideServerName(serverName)
+}
+
+// certReloader caches the certificates read from the files of a TLSConfig, until the files change.
+type certReloader struct {
+	cfg TLSConfig
+
+	mu              sync.Mutex
+	caPool          *x509.CertPool
+	caModTime       time.Time
+	clientCert      *tls.Certificate
+	clientCertMTime time.Time
+}
+
+func (r *certReloader) caCertPool() (*x509.CertPool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := lastModified(r.cfg.CACertFile)
+	if err != nil {
+		return nil, err
+	}
+	if r.caPool != nil && modTime.Equal(r.caModTime) {
+		return r.caPool, nil
+	}
+
+	pem, err := os.ReadFile(r.cfg.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed reading CA certificates %s: %w", r.cfg.CACertFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no valid PEM certificates found in %s", r.cfg.CACertFile)
+	}
+
+	if r.caPool != nil {
+		logrus.Infof("Reloaded the CA certificates from %s", r.cfg.CACertFile)
+	}
+	r.caPool, r.caModTime = pool, modTime
+	return pool, nil
+}
+
+func (r *certReloader) clientCertificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := lastModified(r.cfg.ClientCertFile, r.cfg.ClientKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if r.clientCert != nil && modTime.Equal(r.clientCertMTime) {
+		return r.clientCert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.cfg.ClientCertFile, r.cfg.ClientKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading the client certificate %s: %w", r.cfg.ClientCertFile, err)
+	}
+
+	if r.clientCert != nil {
+		logrus.Infof("Reloaded the client certificate from %s", r.cfg.ClientCertFile)
+	}
+	r.clientCert, r.clientCertMTime = &cert, modTime
+	return &cert, nil
+}
+
+// verifyConnection verifies the server certificate chain, and that it is for serverName, as the standard verification would.
+func (r *certReloader) verifyConnection(cs tls.ConnectionState, serverName string) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("the server sent no certificate")
+	}
+
+	pool, err := r.caCertPool()
+	if err != nil {
+		return err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+	})
+	return err
+}
+
+// lastModified returns the latest modification time of the files.
+func lastModified(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed reading %s: %w", file, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
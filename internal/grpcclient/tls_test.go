@@ -0,0 +1,231 @@
+package grpcclient_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/utilitywarehouse/finance-fulfilment-archive-api-cli/internal/grpcclient"
+)
+
+const testServerName = "archive.test"
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a certificate signed by the CA, and its key, in PEM.
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// startTLSServer starts a server with a certificate for testServerName signed by ca, requiring client certificates
+// signed by clientCA if not nil. It serves a new fakeServer unless one is given.
+func startTLSServer(t *testing.T, ca *testCA, clientCA *testCA, servers ...*fakeServer) *bufconn.Listener {
+	certPEM, keyPEM := ca.issue(t, testServerName, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCA != nil {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		tlsConfig.ClientCAs.AddCert(clientCA.cert)
+	}
+	server := &fakeServer{}
+	if len(servers) > 0 {
+		server = servers[0]
+	}
+	return startFakeServer(t, server, grpc.Creds(credentials.NewTLS(tlsConfig)))
+}
+
+// writeFile writes data to path, moving its modification time forward so that the change is always detected.
+func writeFile(t *testing.T, path string, data []byte) {
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime().Add(time.Second)
+	} else {
+		modTime = time.Now()
+	}
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func checkOverTLS(t *testing.T, lis *bufconn.Listener, creds credentials.TransportCredentials) error {
+	return checkOverTLSAs(t, lis, "bufnet", creds)
+}
+
+func checkOverTLSAs(t *testing.T, lis *bufconn.Listener, target string, creds credentials.TransportCredentials) error {
+	client := dialListenerAs(t, lis, target, nil, grpc.WithTransportCredentials(creds))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCA(t)
+	lis := startTLSServer(t, ca, nil)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, ca.pem)
+
+	creds, err := grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: caFile, ServerName: testServerName})
+	require.NoError(t, err)
+	assert.NoError(t, checkOverTLS(t, lis, creds))
+
+	//	the address is not the name in the certificate
+	creds, err = grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: caFile})
+	require.NoError(t, err)
+	assert.Error(t, checkOverTLS(t, lis, creds))
+
+	//	a certificate from another CA
+	otherCAFile := filepath.Join(t.TempDir(), "other-ca.pem")
+	writeFile(t, otherCAFile, newTestCA(t).pem)
+	creds, err = grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: otherCAFile, ServerName: testServerName})
+	require.NoError(t, err)
+	assert.Error(t, checkOverTLS(t, lis, creds))
+}
+
+func TestTLSWithIPAddress(t *testing.T) {
+	ca := newTestCA(t)
+	lis := startTLSServer(t, ca, nil)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, caFile, ca.pem)
+
+	//	the certificate is not for the IP address
+	creds, err := grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: caFile})
+	require.NoError(t, err)
+	assert.Error(t, checkOverTLSAs(t, lis, "127.0.0.1:8443", creds))
+
+	creds, err = grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: caFile, ServerName: testServerName})
+	require.NoError(t, err)
+	assert.NoError(t, checkOverTLSAs(t, lis, "127.0.0.1:8443", creds))
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca, clientCA := newTestCA(t), newTestCA(t)
+	lis := startTLSServer(t, ca, clientCA)
+
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writeFile(t, caFile, ca.pem)
+	certPEM, keyPEM := clientCA.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	creds, err := grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: caFile, ServerName: testServerName})
+	require.NoError(t, err)
+	assert.Error(t, checkOverTLS(t, lis, creds), "no client certificate")
+
+	creds, err = grpcclient.TransportCredentials(grpcclient.TLSConfig{
+		CACertFile: caFile, ClientCertFile: certFile, ClientKeyFile: keyFile, ServerName: testServerName,
+	})
+	require.NoError(t, err)
+	assert.NoError(t, checkOverTLS(t, lis, creds))
+}
+
+func TestTLSReloadsCertificates(t *testing.T) {
+	ca, clientCA := newTestCA(t), newTestCA(t)
+
+	dir := t.TempDir()
+	caFile, certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writeFile(t, caFile, ca.pem)
+	//	a client certificate the server does not trust
+	certPEM, keyPEM := newTestCA(t).issue(t, "client", x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	creds, err := grpcclient.TransportCredentials(grpcclient.TLSConfig{
+		CACertFile: caFile, ClientCertFile: certFile, ClientKeyFile: keyFile, ServerName: testServerName,
+	})
+	require.NoError(t, err)
+
+	lis := startTLSServer(t, ca, clientCA)
+	assert.Error(t, checkOverTLS(t, lis, creds))
+
+	//	the client certificate is rotated
+	certPEM, keyPEM = clientCA.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	assert.NoError(t, checkOverTLS(t, lis, creds))
+
+	//	the server moves to a certificate of a new CA, which the client trusts once the CA file is updated
+	newCA := newTestCA(t)
+	lis = startTLSServer(t, newCA, clientCA)
+	assert.Error(t, checkOverTLS(t, lis, creds))
+
+	writeFile(t, caFile, newCA.pem)
+	assert.NoError(t, checkOverTLS(t, lis, creds))
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	_, err := grpcclient.TransportCredentials(grpcclient.TLSConfig{ClientCertFile: "client.pem"})
+	assert.Error(t, err)
+
+	_, err = grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	writeFile(t, notPEM, []byte("not a certificate"))
+	_, err = grpcclient.TransportCredentials(grpcclient.TLSConfig{CACertFile: notPEM})
+	assert.Error(t, err)
+}